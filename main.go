@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,6 +15,8 @@ import (
 	"github.com/resmoio/kubernetes-event-exporter/pkg/setup"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var (
@@ -77,24 +80,29 @@ func main() {
 	kubecfg.QPS = cfg.KubeQPS
 	kubecfg.Burst = cfg.KubeBurst
 
-	metrics.Init(*addr, *tlsConf)
+	metrics.Init(*addr, *tlsConf, cfg.Health)
 	metricsStore := metrics.NewMetricsStore(cfg.MetricsNamePrefix)
 
-	engine := exporter.NewEngine(&cfg, &exporter.ChannelBasedReceiverRegistry{MetricsStore: metricsStore})
-	onEvent := engine.OnEvent
-	if len(cfg.ClusterName) != 0 {
-		onEvent = func(event *kube.EnhancedEvent) {
-			// note that per code this value is not set anywhere on the kubernetes side
-			// https://github.com/kubernetes/apimachinery/blob/v0.22.4/pkg/apis/meta/v1/types.go#L276
-			event.ClusterName = cfg.ClusterName
-			engine.OnEvent(event)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var shards *kube.ShardMembership
+	if cfg.Sharding.Enabled {
+		shards, err = kube.NewShardMembership(cfg.Sharding, kubecfg, metricsStore)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot create shard membership")
+		}
+		if err := shards.Join(ctx); err != nil {
+			log.Fatal().Err(err).Msg("cannot join shard group")
 		}
 	}
 
-	w := kube.NewEventWatcher(kubecfg, cfg.Namespace, cfg.MaxEventAgeSeconds, metricsStore, onEvent, cfg.OmitLookup, cfg.CacheSize)
-
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	engine := exporter.NewEngine(&cfg, &exporter.ChannelBasedReceiverRegistry{MetricsStore: metricsStore})
+	engine.MetricsStore = metricsStore
+	if cfg.Silences.Enabled {
+		engine.Silences = newSilences(ctx, cfg.Silences, kubecfg, metricsStore)
+	}
+	watchers := newEventWatchers(&cfg, kubecfg, metricsStore, engine.OnEvent, shards)
 
 	if cfg.LeaderElection.Enabled {
 		var wasLeader bool
@@ -109,12 +117,16 @@ func main() {
 			}
 		}
 
-		l, err := kube.NewLeaderElector(cfg.LeaderElection.LeaderElectionID, kubecfg,
+		l, err := kube.NewLeaderElector(cfg.LeaderElection, kubecfg,
 			// this method gets called when this instance becomes the leader
 			func(_ context.Context) {
 				wasLeader = true
 				log.Info().Msg("leader election won")
-				w.Start()
+				if cfg.LeaderElection.Standby {
+					promoteWatchers(watchers)
+				} else {
+					startWatchers(watchers)
+				}
 			},
 			// this method gets called when the leader election loop is closed
 			// either due to context cancellation or due to losing the leader lease
@@ -129,6 +141,33 @@ func main() {
 			log.Fatal().Err(err).Msg("create leaderelector failed")
 		}
 
+		if cfg.LeaderElection.Standby {
+			log.Info().Msg("Starting watchers in standby until the leader election is won")
+			startWatchers(watchers)
+		}
+
+		if cfg.LeaderElection.ReleaseOnCancel {
+			// The leader election loop gets its own context so that the lease is only released after the pending
+			// events are exported. The next leader can take over right away without losing events.
+			leaderCtx, cancelLeader := context.WithCancel(context.Background())
+			leaderDone := make(chan struct{})
+			go func() {
+				l.Run(leaderCtx)
+				close(leaderDone)
+			}()
+
+			select {
+			case <-ctx.Done():
+			case <-leaderDone:
+			}
+
+			log.Info().Msg("Stopping and exporting pending events before releasing the leader lease.")
+			stop(watchers, engine)
+			cancelLeader()
+			<-leaderDone
+			return
+		}
+
 		// Run returns if either the context is canceled or client stopped holding the leader lease
 		l.Run(ctx)
 
@@ -138,16 +177,124 @@ func main() {
 		// so that we don't lose events until the next leader is elected. The new leader
 		// will only be elected after leaseDuration seconds.
 		if wasLeader {
-			log.Info().Msgf("waiting leaseDuration seconds before stopping: %s", kube.GetLeaseDuration())
-			time.Sleep(kube.GetLeaseDuration())
+			log.Info().Msgf("waiting leaseDuration seconds before stopping: %s", cfg.LeaderElection.GetLeaseDuration())
+			time.Sleep(cfg.LeaderElection.GetLeaseDuration())
 		}
 	} else {
 		log.Info().Msg("leader election disabled")
-		w.Start()
+		if shards != nil {
+			shardsCtx, cancelShards := context.WithCancel(context.Background())
+			shardsDone := make(chan struct{})
+			go func() {
+				shards.Run(shardsCtx)
+				close(shardsDone)
+			}()
+			// The lease is only given up once the pending events are exported, the other replicas take over then
+			defer func() {
+				cancelShards()
+				<-shardsDone
+			}()
+		}
+		startWatchers(watchers)
 		<-ctx.Done()
 	}
 
 	log.Info().Msg("Received signal to exit. Stopping.")
-	w.Stop()
+	stop(watchers, engine)
+}
+
+// newEventWatchers creates a single watcher for the cluster the exporter runs in, or one watcher per cluster in
+// multi-cluster mode. All of them feed the same engine and share the shards of this replica.
+func newEventWatchers(cfg *exporter.Config, kubecfg *rest.Config, metricsStore *metrics.Store, onEvent kube.EventHandler, shards *kube.ShardMembership) []*kube.EventWatcher {
+	watcherCfg := kube.WatcherConfig{
+		ClusterName:        cfg.ClusterName,
+		Namespace:          cfg.Namespace,
+		Namespaces:         cfg.Namespaces,
+		MaxEventAgeSeconds: cfg.MaxEventAgeSeconds,
+		OmitLookup:         cfg.OmitLookup,
+		CacheSize:          cfg.CacheSize,
+		Updates:            cfg.Updates,
+		Dedup:              cfg.Dedup,
+		EventsAPIVersion:   cfg.EventsAPIVersion,
+		Checkpoint:         cfg.Checkpoint,
+		Selectors:          cfg.Selectors,
+		OwnerChain:         cfg.OwnerChain,
+		Standby:            cfg.LeaderElection.Enabled && cfg.LeaderElection.Standby,
+		Discovery:          cfg.Discovery,
+		MetadataInformers:  cfg.MetadataInformers,
+		Enrichment:         cfg.Enrichment,
+		Shards:             shards,
+	}
+
+	if len(cfg.Clusters) == 0 {
+		return []*kube.EventWatcher{kube.NewEventWatcher(kubecfg, watcherCfg, metricsStore, onEvent)}
+	}
+
+	localClientset := kubernetes.NewForConfigOrDie(kubecfg)
+	watchers := make([]*kube.EventWatcher, 0, len(cfg.Clusters))
+	for _, cluster := range cfg.Clusters {
+		clusterCfg, err := kube.GetClusterConfig(cluster, kubecfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot get cluster config")
+		}
+
+		c := watcherCfg
+		c.ClusterName = cluster.Name
+		c.CacheSize = cluster.CacheSize
+
+		// Checkpoints of all clusters are kept next to the exporter, one per cluster
+		if c.Checkpoint.Enabled {
+			checkpointCfg := c.Checkpoint
+			if checkpointCfg.Name != "" {
+				checkpointCfg.Name += "-" + cluster.Name
+			} else {
+				checkpointCfg.Name = "kubernetes-event-exporter-checkpoint-" + cluster.Name
+			}
+			if checkpointCfg.Path != "" {
+				checkpointCfg.Path += "." + cluster.Name
+			}
+			c.CheckpointStore, err = kube.NewCheckpointStore(checkpointCfg, localClientset)
+			if err != nil {
+				log.Fatal().Err(err).Msg("cannot create checkpoint store")
+			}
+		}
+
+		log.Info().Str("cluster", cluster.Name).Str("host", clusterCfg.Host).Msg("Watching cluster")
+		watchers = append(watchers, kube.NewEventWatcher(clusterCfg, c, metricsStore, onEvent))
+	}
+	return watchers
+}
+
+// newSilences loads the silences and serves the silences API on the metrics server, they are reloaded in the
+// background to pick up the silences created on other replicas
+func newSilences(ctx context.Context, cfg exporter.SilencesConfig, kubecfg *rest.Config, metricsStore *metrics.Store) *exporter.Silences {
+	silences := exporter.NewSilences(cfg, kubernetes.NewForConfigOrDie(kubecfg), metricsStore)
+	if err := silences.Load(ctx); err != nil {
+		log.Fatal().Err(err).Msg("cannot load silences")
+	}
+	go silences.Run(ctx)
+
+	http.Handle(exporter.SilencesPath, silences)
+	http.Handle(exporter.SilencesPath+"/", silences)
+	return silences
+}
+
+func startWatchers(watchers []*kube.EventWatcher) {
+	for _, w := range watchers {
+		w.Start()
+	}
+}
+
+func promoteWatchers(watchers []*kube.EventWatcher) {
+	for _, w := range watchers {
+		w.Promote()
+	}
+}
+
+// stop stops the watchers and waits for the sinks to export the pending events
+func stop(watchers []*kube.EventWatcher, engine *exporter.Engine) {
+	for _, w := range watchers {
+		w.Stop()
+	}
 	engine.Stop()
 }
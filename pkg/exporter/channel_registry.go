@@ -19,6 +19,10 @@ type ChannelBasedReceiverRegistry struct {
 	ch     map[string]chan kube.EnhancedEvent
 	exitCh map[string]chan interface{}
 	wg     *sync.WaitGroup
+	// pending counts the events that are not handed to their sink yet
+	pending      sync.WaitGroup
+	healthMu     sync.RWMutex
+	health       map[string]*receiverHealth
 	MetricsStore *metrics.Store
 }
 
@@ -26,9 +30,12 @@ func (r *ChannelBasedReceiverRegistry) SendEvent(name string, event *kube.Enhanc
 	ch := r.ch[name]
 	if ch == nil {
 		log.Error().Str("name", name).Msg("There is no channel")
+		return
 	}
 
+	r.pending.Add(1)
 	go func() {
+		defer r.pending.Done()
 		ch <- *event
 	}()
 }
@@ -37,13 +44,19 @@ func (r *ChannelBasedReceiverRegistry) Register(name string, receiver sinks.Sink
 	if r.ch == nil {
 		r.ch = make(map[string]chan kube.EnhancedEvent)
 		r.exitCh = make(map[string]chan interface{})
+		r.health = make(map[string]*receiverHealth)
+		r.registerHealth()
 	}
 
 	ch := make(chan kube.EnhancedEvent)
 	exitCh := make(chan interface{})
 
+	health := &receiverHealth{}
 	r.ch[name] = ch
 	r.exitCh[name] = exitCh
+	r.healthMu.Lock()
+	r.health[name] = health
+	r.healthMu.Unlock()
 
 	if r.wg == nil {
 		r.wg = &sync.WaitGroup{}
@@ -56,7 +69,9 @@ func (r *ChannelBasedReceiverRegistry) Register(name string, receiver sinks.Sink
 			select {
 			case ev := <-ch:
 				log.Debug().Str("sink", name).Str("event", ev.Message).Msg("sending event to sink")
+				health.sending()
 				err := receiver.Send(context.Background(), &ev)
+				health.sent(err)
 				if err != nil {
 					r.MetricsStore.SendErrors.Inc()
 					log.Debug().Err(err).Str("sink", name).Str("event", ev.Message).Msg("Cannot send event")
@@ -75,6 +90,9 @@ func (r *ChannelBasedReceiverRegistry) Register(name string, receiver sinks.Sink
 // Close signals closing to all sinks and waits for them to complete.
 // The wait could block indefinitely depending on the sink implementations.
 func (r *ChannelBasedReceiverRegistry) Close() {
+	// Hand the pending events to the sinks first, they are sent before the sinks see the exit command
+	r.pending.Wait()
+
 	// Send exit command and wait for exit of all sinks
 	for _, ec := range r.exitCh {
 		ec <- 1
@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelBasedReceiverRegistry_CloseFlushesPendingEvents(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	sink := &sinks.InMemory{}
+	registry := &ChannelBasedReceiverRegistry{MetricsStore: metricsStore}
+	registry.Register("in-mem", sink)
+
+	for i := 0; i < 100; i++ {
+		registry.SendEvent("in-mem", &kube.EnhancedEvent{})
+	}
+	registry.SendEvent("unknown", &kube.EnhancedEvent{})
+	registry.Close()
+
+	require.Len(t, sink.Events, 100)
+}
+
+type failingSink struct{}
+
+func (failingSink) Send(_ context.Context, _ *kube.EnhancedEvent) error {
+	return errors.New("connection refused")
+}
+
+func (failingSink) Close() {}
+
+func TestChannelBasedReceiverRegistry_Health(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	registry := &ChannelBasedReceiverRegistry{MetricsStore: metricsStore}
+	registry.Register("in-mem", &sinks.InMemory{})
+	registry.Register("failing", failingSink{})
+	require.NoError(t, registry.checkReady())
+
+	registry.SendEvent("failing", &kube.EnhancedEvent{})
+	registry.SendEvent("in-mem", &kube.EnhancedEvent{})
+	registry.Close()
+
+	// One failing receiver does not make the exporter unready
+	require.NoError(t, registry.checkReady())
+	require.True(t, registry.busySince().IsZero())
+
+	statuses := registry.status().(map[string]receiverStatus)
+	require.True(t, statuses["in-mem"].Healthy)
+	require.NotNil(t, statuses["in-mem"].LastSuccess)
+	require.Equal(t, int64(1), statuses["failing"].Errors)
+	require.Equal(t, "connection refused", statuses["failing"].LastErrorMessage)
+
+	for i := 0; i < receiverFailingErrors; i++ {
+		registry.health["failing"].sent(errors.New("connection refused"))
+		registry.health["in-mem"].sent(errors.New("timeout"))
+	}
+	require.False(t, registry.status().(map[string]receiverStatus)["failing"].Healthy)
+	require.EqualError(t, registry.checkReady(), "all receivers are failing")
+}
+
+func TestChannelBasedReceiverRegistry_HealthSingleReceiver(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	registry := &ChannelBasedReceiverRegistry{MetricsStore: metricsStore}
+	registry.Register("slack", &sinks.InMemory{})
+	defer registry.Close()
+	h := registry.health["slack"]
+
+	// A transient error, e.g. a rate limit, keeps the exporter ready
+	h.sent(nil)
+	h.sent(errors.New("429 too many requests"))
+	require.NoError(t, registry.checkReady())
+
+	for i := 1; i < receiverFailingErrors; i++ {
+		h.sent(errors.New("429 too many requests"))
+	}
+	require.EqualError(t, registry.checkReady(), "all receivers are failing")
+
+	// Without further sends the receiver recovers after a while
+	h.lastError = time.Now().Add(-receiverFailingWindow)
+	require.NoError(t, registry.checkReady())
+
+	h.sent(errors.New("429 too many requests"))
+	require.EqualError(t, registry.checkReady(), "all receivers are failing")
+	h.sent(nil)
+	require.NoError(t, registry.checkReady())
+}
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
 	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
 )
 
 const (
@@ -21,20 +26,34 @@ type Config struct {
 	// Route is the top route that the events will match
 	// TODO: There is currently a tight coupling with route and config, but not with receiver config and sink so
 	// TODO: I am not sure what to do here.
-	LogLevel           string                    `yaml:"logLevel"`
-	LogFormat          string                    `yaml:"logFormat"`
-	ThrottlePeriod     int64                     `yaml:"throttlePeriod"`
-	MaxEventAgeSeconds int64                     `yaml:"maxEventAgeSeconds"`
-	ClusterName        string                    `yaml:"clusterName,omitempty"`
-	Namespace          string                    `yaml:"namespace"`
-	LeaderElection     kube.LeaderElectionConfig `yaml:"leaderElection"`
-	Route              Route                     `yaml:"route"`
-	Receivers          []sinks.ReceiverConfig    `yaml:"receivers"`
-	KubeQPS            float32                   `yaml:"kubeQPS,omitempty"`
-	KubeBurst          int                       `yaml:"kubeBurst,omitempty"`
-	MetricsNamePrefix  string                    `yaml:"metricsNamePrefix,omitempty"`
-	OmitLookup         bool                      `yaml:"omitLookup,omitempty"`
-	CacheSize          int                       `yaml:"cacheSize,omitempty"`
+	LogLevel           string                       `yaml:"logLevel"`
+	LogFormat          string                       `yaml:"logFormat"`
+	ThrottlePeriod     int64                        `yaml:"throttlePeriod"`
+	MaxEventAgeSeconds int64                        `yaml:"maxEventAgeSeconds"`
+	ClusterName        string                       `yaml:"clusterName,omitempty"`
+	Clusters           []kube.ClusterConfig         `yaml:"clusters,omitempty"`
+	Namespace          string                       `yaml:"namespace"`
+	Namespaces         kube.NamespacesConfig        `yaml:"namespaces"`
+	Selectors          kube.EventSelectorConfig     `yaml:"selectors"`
+	EventsAPIVersion   string                       `yaml:"eventsAPIVersion,omitempty"`
+	LeaderElection     kube.LeaderElectionConfig    `yaml:"leaderElection"`
+	Sharding           kube.ShardingConfig          `yaml:"sharding"`
+	Updates            kube.UpdateConfig            `yaml:"updates"`
+	Dedup              kube.DedupConfig             `yaml:"dedup"`
+	Checkpoint         kube.CheckpointConfig        `yaml:"checkpoint"`
+	Silences           SilencesConfig               `yaml:"silences"`
+	Route              Route                        `yaml:"route"`
+	Receivers          []sinks.ReceiverConfig       `yaml:"receivers"`
+	KubeQPS            float32                      `yaml:"kubeQPS,omitempty"`
+	KubeBurst          int                          `yaml:"kubeBurst,omitempty"`
+	MetricsNamePrefix  string                       `yaml:"metricsNamePrefix,omitempty"`
+	Health             metrics.HealthConfig         `yaml:"health"`
+	OmitLookup         bool                         `yaml:"omitLookup,omitempty"`
+	OwnerChain         kube.OwnerChainConfig        `yaml:"ownerChain"`
+	Discovery          kube.DiscoveryConfig         `yaml:"discovery"`
+	MetadataInformers  kube.MetadataInformersConfig `yaml:"metadataInformers"`
+	Enrichment         kube.EnrichmentConfig        `yaml:"enrichment"`
+	CacheSize          int                          `yaml:"cacheSize,omitempty"`
 }
 
 func (c *Config) SetDefaults() {
@@ -52,6 +71,19 @@ func (c *Config) SetDefaults() {
 		c.KubeQPS = rest.DefaultQPS
 		log.Debug().Msg(fmt.Sprintf("setting config.kubeQPS=%.2f (default)", rest.DefaultQPS))
 	}
+
+	// Clusters inherit the global settings unless they override them
+	for i := range c.Clusters {
+		if c.Clusters[i].CacheSize == 0 {
+			c.Clusters[i].CacheSize = c.CacheSize
+		}
+		if c.Clusters[i].KubeBurst == 0 {
+			c.Clusters[i].KubeBurst = c.KubeBurst
+		}
+		if c.Clusters[i].KubeQPS == 0 {
+			c.Clusters[i].KubeQPS = c.KubeQPS
+		}
+	}
 }
 
 func (c *Config) Validate() error {
@@ -61,10 +93,54 @@ func (c *Config) Validate() error {
 	if err := c.validateMetricsNamePrefix(); err != nil {
 		return err
 	}
+	if err := c.validateHealth(); err != nil {
+		return err
+	}
+	if err := c.validateUpdates(); err != nil {
+		return err
+	}
+	if err := c.validateDedup(); err != nil {
+		return err
+	}
+	if err := c.validateEventsAPIVersion(); err != nil {
+		return err
+	}
+	if err := c.validateCheckpoint(); err != nil {
+		return err
+	}
+	if err := c.validateNamespaces(); err != nil {
+		return err
+	}
+	if err := c.validateSelectors(); err != nil {
+		return err
+	}
+	if err := c.validateClusters(); err != nil {
+		return err
+	}
+	if err := c.validateDiscovery(); err != nil {
+		return err
+	}
+	if err := c.validateEnrichment(); err != nil {
+		return err
+	}
+	if err := c.validateLeaderElection(); err != nil {
+		return err
+	}
+	if err := c.validateSharding(); err != nil {
+		return err
+	}
+	if err := c.validateSilences(); err != nil {
+		return err
+	}
+	if err := c.validateRoute(); err != nil {
+		return err
+	}
+	if err := c.validateReceivers(); err != nil {
+		return err
+	}
 
 	// No duplicate receivers
 	// Receivers individually
-	// Routers recursive
 	return nil
 }
 
@@ -112,3 +188,260 @@ func (c *Config) validateMetricsNamePrefix() error {
 	}
 	return nil
 }
+
+func (c *Config) validateDedup() error {
+	if c.Dedup.TTLSeconds < 0 || c.Dedup.CacheSize < 0 {
+		log.Error().Msg("config.dedup settings cannot be negative")
+		return errors.New("validateDedup failed")
+	}
+	return nil
+}
+
+func (c *Config) validateHealth() error {
+	if c.Health.StallTimeoutSeconds < 0 {
+		log.Error().Msg("config.health.stallTimeoutSeconds cannot be negative")
+		return errors.New("validateHealth failed")
+	}
+	return nil
+}
+
+func (c *Config) validateUpdates() error {
+	switch c.Updates.Mode {
+	case "":
+		c.Updates.Mode = kube.UpdateModeIgnore
+	case kube.UpdateModeIgnore, kube.UpdateModeExport:
+	default:
+		log.Error().Str("mode", c.Updates.Mode).Msg("config.updates.mode should be one of: ignore, export")
+		return errors.New("validateUpdates failed")
+	}
+
+	if c.Updates.MinIntervalSeconds < 0 {
+		log.Error().Msg("config.updates.minIntervalSeconds cannot be negative")
+		return errors.New("validateUpdates failed")
+	}
+	return nil
+}
+
+func (c *Config) validateEventsAPIVersion() error {
+	switch c.EventsAPIVersion {
+	case "":
+		c.EventsAPIVersion = kube.EventsAPICoreV1
+	case kube.EventsAPICoreV1, kube.EventsAPIEventsV1:
+	default:
+		log.Error().Str("eventsAPIVersion", c.EventsAPIVersion).Msg("config.eventsAPIVersion should be one of: v1, events.k8s.io/v1")
+		return errors.New("validateEventsAPIVersion failed")
+	}
+	return nil
+}
+
+func (c *Config) validateCheckpoint() error {
+	if !c.Checkpoint.Enabled {
+		return nil
+	}
+
+	switch c.Checkpoint.Storage {
+	case "", kube.CheckpointStorageConfigMap:
+	case kube.CheckpointStorageFile:
+		if c.Checkpoint.Path == "" {
+			log.Error().Msg("config.checkpoint.path is required for the file storage")
+			return errors.New("validateCheckpoint failed")
+		}
+	default:
+		log.Error().Str("storage", c.Checkpoint.Storage).Msg("config.checkpoint.storage should be one of: configmap, file")
+		return errors.New("validateCheckpoint failed")
+	}
+	return nil
+}
+
+func (c *Config) validateNamespaces() error {
+	if c.Namespace != "" && !c.Namespaces.IsEmpty() {
+		log.Error().Msg("cannot set both namespace and namespaces, use namespaces.include instead")
+		return errors.New("validateNamespaces failed")
+	}
+
+	if c.Namespaces.LabelSelector != "" {
+		if _, err := labels.Parse(c.Namespaces.LabelSelector); err != nil {
+			log.Error().Err(err).Msg("config.namespaces.labelSelector is not a valid label selector")
+			return errors.New("validateNamespaces failed")
+		}
+	}
+
+	if c.Namespaces.PerNamespaceInformers && len(c.Namespaces.Include) == 0 && c.Namespaces.LabelSelector == "" {
+		log.Error().Msg("config.namespaces.perNamespaceInformers requires namespaces.include or namespaces.labelSelector")
+		return errors.New("validateNamespaces failed")
+	}
+	return nil
+}
+
+func (c *Config) validateSelectors() error {
+	if _, err := c.Selectors.BuildFieldSelector(c.EventsAPIVersion); err != nil {
+		log.Error().Err(err).Msg("config.selectors.fieldSelector is not a valid field selector")
+		return errors.New("validateSelectors failed")
+	}
+
+	if c.Selectors.LabelSelector != "" {
+		if _, err := labels.Parse(c.Selectors.LabelSelector); err != nil {
+			log.Error().Err(err).Msg("config.selectors.labelSelector is not a valid label selector")
+			return errors.New("validateSelectors failed")
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateDiscovery() error {
+	if c.Discovery.RefreshIntervalSeconds < 0 {
+		log.Error().Msg("config.discovery.refreshIntervalSeconds cannot be negative")
+		return errors.New("validateDiscovery failed")
+	}
+	return nil
+}
+
+func (c *Config) validateEnrichment() error {
+	if c.Enrichment.Workers < 0 || c.Enrichment.QueueSize < 0 || c.Enrichment.TimeoutSeconds < 0 || c.Enrichment.NotFoundCacheSeconds < 0 {
+		log.Error().Msg("config.enrichment settings cannot be negative")
+		return errors.New("validateEnrichment failed")
+	}
+	if c.Enrichment.Logs.Lines < 0 || c.Enrichment.Logs.MaxBytes < 0 || c.Enrichment.Logs.PerMinute < 0 {
+		log.Error().Msg("config.enrichment.logs settings cannot be negative")
+		return errors.New("validateEnrichment failed")
+	}
+	return nil
+}
+
+func (c *Config) validateLeaderElection() error {
+	le := c.LeaderElection
+	if le.LeaseDurationSeconds < 0 || le.RenewDeadlineSeconds < 0 || le.RetryPeriodSeconds < 0 {
+		log.Error().Msg("config.leaderElection timings cannot be negative")
+		return errors.New("validateLeaderElection failed")
+	}
+
+	if le.Standby && (!le.Enabled || !c.Checkpoint.Enabled) {
+		log.Error().Msg("config.leaderElection.standby requires leaderElection.enabled and checkpoint.enabled")
+		return errors.New("validateLeaderElection failed")
+	}
+
+	// The same constraints are checked by client-go, but only once the exporter is up
+	if le.GetLeaseDuration() <= le.GetRenewDeadline() ||
+		le.GetRenewDeadline() <= time.Duration(leaderelection.JitterFactor*float64(le.GetRetryPeriod())) {
+		log.Error().
+			Str("leaseDuration", le.GetLeaseDuration().String()).
+			Str("renewDeadline", le.GetRenewDeadline().String()).
+			Str("retryPeriod", le.GetRetryPeriod().String()).
+			Msg("config.leaderElection requires leaseDurationSeconds > renewDeadlineSeconds > 1.2 * retryPeriodSeconds")
+		return errors.New("validateLeaderElection failed")
+	}
+	return nil
+}
+
+func (c *Config) validateSharding() error {
+	sh := c.Sharding
+	if !sh.Enabled {
+		return nil
+	}
+
+	switch sh.Key {
+	case "", kube.ShardKeyNamespace, kube.ShardKeyUID:
+	default:
+		log.Error().Str("key", sh.Key).Msg("config.sharding.key should be one of: namespace, uid")
+		return errors.New("validateSharding failed")
+	}
+
+	// Every replica exports its own share, there is neither a single leader nor a single checkpoint
+	if c.LeaderElection.Enabled || c.Checkpoint.Enabled {
+		log.Error().Msg("config.sharding cannot be combined with leaderElection or checkpoint")
+		return errors.New("validateSharding failed")
+	}
+
+	if sh.LeaseDurationSeconds < 0 || sh.RenewIntervalSeconds < 0 {
+		log.Error().Msg("config.sharding timings cannot be negative")
+		return errors.New("validateSharding failed")
+	}
+	if sh.GetRenewInterval() >= sh.GetLeaseDuration() {
+		log.Error().
+			Str("leaseDuration", sh.GetLeaseDuration().String()).
+			Str("renewInterval", sh.GetRenewInterval().String()).
+			Msg("config.sharding requires leaseDurationSeconds > renewIntervalSeconds")
+		return errors.New("validateSharding failed")
+	}
+	return nil
+}
+
+func (c *Config) validateSilences() error {
+	if c.Silences.Enabled && c.Silences.RefreshSeconds < 0 {
+		log.Error().Int64("refreshSeconds", c.Silences.RefreshSeconds).Msg("config.silences.refreshSeconds cannot be negative")
+		return errors.New("validateSilences failed")
+	}
+	return nil
+}
+
+// validateRoute compiles the rules once, so that invalid patterns are reported on startup
+func (c *Config) validateRoute() error {
+	if err := c.Route.Compile("route"); err != nil {
+		log.Error().Err(err).Msg("config.route has an invalid rule")
+		return errors.New("validateRoute failed")
+	}
+	return nil
+}
+
+// validateReceivers checks the rate limits and grouping of the receivers, the rate limits of the routes are checked
+// with the route
+func (c *Config) validateReceivers() error {
+	for _, r := range c.Receivers {
+		if r.RateLimit != nil {
+			if _, err := newEventLimiter(r.Name, *r.RateLimit); err != nil {
+				log.Error().Err(err).Str("name", r.Name).Msg("config.receivers has an invalid rateLimit")
+				return errors.New("validateReceivers failed")
+			}
+		}
+		if r.Group != nil {
+			if r.Group.WaitSeconds < 0 || r.Group.IntervalSeconds < 0 {
+				log.Error().Str("name", r.Name).Msg("config.receivers group settings cannot be negative")
+				return errors.New("validateReceivers failed")
+			}
+			if _, err := newEventGrouper(r.Name, *r.Group); err != nil {
+				log.Error().Err(err).Str("name", r.Name).Msg("config.receivers has an invalid group.by")
+				return errors.New("validateReceivers failed")
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateClusters() error {
+	if len(c.Clusters) == 0 {
+		return nil
+	}
+
+	if c.ClusterName != "" {
+		log.Error().Msg("cannot set both clusterName and clusters, set the name of each cluster instead")
+		return errors.New("validateClusters failed")
+	}
+
+	names := make(map[string]struct{}, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		if cluster.Name == "" {
+			log.Error().Msg("config.clusters[].name is required")
+			return errors.New("validateClusters failed")
+		}
+		// The name is part of the checkpoint ConfigMap names and the metric labels
+		if errs := validation.IsDNS1123Label(cluster.Name); len(errs) > 0 {
+			log.Error().Str("name", cluster.Name).Strs("errors", errs).Msg("config.clusters[].name must be a DNS-1123 label")
+			return errors.New("validateClusters failed")
+		}
+		if _, ok := names[cluster.Name]; ok {
+			log.Error().Str("name", cluster.Name).Msg("config.clusters[].name must be unique")
+			return errors.New("validateClusters failed")
+		}
+		names[cluster.Name] = struct{}{}
+
+		if cluster.Secret != nil && cluster.Kubeconfig != "" {
+			log.Error().Str("name", cluster.Name).Msg("cannot set both kubeconfig and secret for a cluster")
+			return errors.New("validateClusters failed")
+		}
+		if cluster.Secret != nil && (cluster.Secret.Namespace == "" || cluster.Secret.Name == "") {
+			log.Error().Str("name", cluster.Name).Msg("config.clusters[].secret requires namespace and name")
+			return errors.New("validateClusters failed")
+		}
+	}
+	return nil
+}
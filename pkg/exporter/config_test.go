@@ -3,8 +3,12 @@ package exporter
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -158,3 +162,195 @@ func TestSetDefaults(t *testing.T) {
 	require.Equal(t, rest.DefaultQPS, config.KubeQPS)
 	require.Equal(t, rest.DefaultBurst, config.KubeBurst)
 }
+
+func TestValidate_Updates(t *testing.T) {
+	config := Config{}
+	require.NoError(t, config.Validate())
+	require.Equal(t, kube.UpdateModeIgnore, config.Updates.Mode)
+
+	config = Config{Updates: kube.UpdateConfig{Mode: kube.UpdateModeExport, MinIntervalSeconds: 30}}
+	require.NoError(t, config.Validate())
+
+	config = Config{Updates: kube.UpdateConfig{Mode: "sometimes"}}
+	require.Error(t, config.Validate())
+
+	config = Config{Updates: kube.UpdateConfig{Mode: kube.UpdateModeExport, MinIntervalSeconds: -1}}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_EventsAPIVersion(t *testing.T) {
+	config := Config{}
+	require.NoError(t, config.Validate())
+	require.Equal(t, kube.EventsAPICoreV1, config.EventsAPIVersion)
+
+	config = Config{EventsAPIVersion: kube.EventsAPIEventsV1}
+	require.NoError(t, config.Validate())
+
+	config = Config{EventsAPIVersion: "events.k8s.io/v1beta1"}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Namespaces(t *testing.T) {
+	config := Config{Namespaces: kube.NamespacesConfig{Include: []string{"a", "b"}, PerNamespaceInformers: true}}
+	require.NoError(t, config.Validate())
+
+	config = Config{Namespaces: kube.NamespacesConfig{LabelSelector: "team=payments,env!=dev"}}
+	require.NoError(t, config.Validate())
+
+	config = Config{Namespace: "a", Namespaces: kube.NamespacesConfig{Include: []string{"b"}}}
+	require.Error(t, config.Validate())
+
+	config = Config{Namespaces: kube.NamespacesConfig{LabelSelector: "team in (a"}}
+	require.Error(t, config.Validate())
+
+	config = Config{Namespaces: kube.NamespacesConfig{Exclude: []string{"a"}, PerNamespaceInformers: true}}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Clusters(t *testing.T) {
+	config := Config{Clusters: []kube.ClusterConfig{{Name: "eu"}, {Name: "us", Context: "us"}}}
+	require.NoError(t, config.Validate())
+
+	config = Config{ClusterName: "eu", Clusters: []kube.ClusterConfig{{Name: "eu"}}}
+	require.Error(t, config.Validate())
+
+	config = Config{Clusters: []kube.ClusterConfig{{Name: "eu"}, {Name: "eu"}}}
+	require.Error(t, config.Validate())
+
+	config = Config{Clusters: []kube.ClusterConfig{{Context: "eu"}}}
+	require.Error(t, config.Validate())
+
+	config = Config{Clusters: []kube.ClusterConfig{{Name: "Prod_EU"}}}
+	require.Error(t, config.Validate())
+
+	config = Config{Clusters: []kube.ClusterConfig{{Name: "eu", Secret: &kube.KubeconfigSecretRef{Name: "eu"}}}}
+	require.Error(t, config.Validate())
+}
+
+func TestSetDefaults_Clusters(t *testing.T) {
+	config := Config{
+		KubeQPS: 50,
+		Clusters: []kube.ClusterConfig{
+			{Name: "eu"},
+			{Name: "us", KubeQPS: 10, CacheSize: 16},
+		},
+	}
+	config.SetDefaults()
+
+	require.Equal(t, float32(50), config.Clusters[0].KubeQPS)
+	require.Equal(t, rest.DefaultBurst, config.Clusters[0].KubeBurst)
+	require.Equal(t, DefaultCacheSize, config.Clusters[0].CacheSize)
+	require.Equal(t, float32(10), config.Clusters[1].KubeQPS)
+	require.Equal(t, 16, config.Clusters[1].CacheSize)
+}
+
+func TestValidate_LeaderElection(t *testing.T) {
+	config := Config{LeaderElection: kube.LeaderElectionConfig{Enabled: true}}
+	require.NoError(t, config.Validate())
+
+	config = Config{LeaderElection: kube.LeaderElectionConfig{LeaseDurationSeconds: 30, RenewDeadlineSeconds: 20, RetryPeriodSeconds: 5}}
+	require.NoError(t, config.Validate())
+
+	// The renew deadline defaults to 10s which is not shorter than the lease
+	config = Config{LeaderElection: kube.LeaderElectionConfig{LeaseDurationSeconds: 10}}
+	require.Error(t, config.Validate())
+
+	config = Config{LeaderElection: kube.LeaderElectionConfig{RenewDeadlineSeconds: 5, RetryPeriodSeconds: 5}}
+	require.Error(t, config.Validate())
+
+	config = Config{LeaderElection: kube.LeaderElectionConfig{RetryPeriodSeconds: -1}}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Sharding(t *testing.T) {
+	config := Config{Sharding: kube.ShardingConfig{Enabled: true, Key: kube.ShardKeyUID}}
+	require.NoError(t, config.Validate())
+
+	config = Config{Sharding: kube.ShardingConfig{Enabled: true, Key: "reason"}}
+	require.Error(t, config.Validate())
+
+	config = Config{Sharding: kube.ShardingConfig{Enabled: true}, LeaderElection: kube.LeaderElectionConfig{Enabled: true}}
+	require.Error(t, config.Validate())
+
+	config = Config{Sharding: kube.ShardingConfig{Enabled: true}, Checkpoint: kube.CheckpointConfig{Enabled: true}}
+	require.Error(t, config.Validate())
+
+	// The renew interval defaults to 5s
+	config = Config{Sharding: kube.ShardingConfig{Enabled: true, LeaseDurationSeconds: 5}}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Silences(t *testing.T) {
+	config := readConfig(t, `
+silences:
+  enabled: true
+  name: maintenance
+  refreshSeconds: 10
+`)
+	require.NoError(t, config.Validate())
+	require.Equal(t, "maintenance", config.Silences.Name)
+	require.Equal(t, 10*time.Second, config.Silences.GetRefresh())
+
+	config = Config{Silences: SilencesConfig{Enabled: true, RefreshSeconds: -1}}
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Route(t *testing.T) {
+	config := Config{Route: Route{Routes: []Route{{Match: []Rule{{Namespace: "kube-*", Receiver: "dump"}}}}}}
+	require.NoError(t, config.Validate())
+	// The rules are compiled by the validation
+	require.NotNil(t, config.Route.Routes[0].Match[0].compiled)
+
+	config = Config{Route: Route{Drop: []Rule{{Reason: "BackOff["}}}}
+	require.Error(t, config.Validate())
+
+	config = readConfig(t, `
+route:
+  drop:
+    - expr: event.count > "3"
+`)
+	require.Equal(t, `event.count > "3"`, config.Route.Drop[0].Expr)
+	require.Error(t, config.Validate())
+}
+
+func TestValidate_Receivers(t *testing.T) {
+	config := readConfig(t, `
+route:
+  rateLimit:
+    limit: 10
+    intervalSeconds: 60
+    overflow: summarize
+receivers:
+  - name: slack
+    stdout: {}
+    rateLimit:
+      limit: 5
+      key: "{{ .Namespace }}"
+`)
+	require.NoError(t, config.Validate())
+	require.NotNil(t, config.Route.limiter)
+	require.Equal(t, "{{ .Namespace }}", config.Receivers[0].RateLimit.Key)
+
+	config.Receivers[0].RateLimit.Overflow = "queue"
+	require.Error(t, config.Validate())
+
+	config = Config{Route: Route{RateLimit: &ratelimit.Config{}}}
+	require.Error(t, config.Validate())
+
+	config = readConfig(t, `
+receivers:
+  - name: slack
+    stdout: {}
+    group:
+      by: "{{ .Namespace }}/{{ .Reason }}"
+      waitSeconds: 10
+`)
+	require.NoError(t, config.Validate())
+	require.Equal(t, int64(10), config.Receivers[0].Group.WaitSeconds)
+
+	config.Receivers[0].Group.By = "{{ .Namespace"
+	require.Error(t, config.Validate())
+
+	config.Receivers[0].Group = &sinks.GroupConfig{IntervalSeconds: -1}
+	require.Error(t, config.Validate())
+}
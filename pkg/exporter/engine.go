@@ -2,8 +2,10 @@ package exporter
 
 import (
 	"reflect"
+	"time"
 
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
 	"github.com/rs/zerolog/log"
 )
 
@@ -11,6 +13,32 @@ import (
 type Engine struct {
 	Route    Route
 	Registry ReceiverRegistry
+	// MetricsStore counts the events that matched no rule, were rate limited or silenced, it is optional
+	MetricsStore *metrics.Store
+	// Silences drops the events that match an active silence before they are routed, it is optional
+	Silences *Silences
+
+	// receivers applies the rate limits of the receivers before handing events to groups, which sends digests of the
+	// events of receivers with grouping to the registry
+	receivers *limitedRegistry
+	groups    *groupingRegistry
+	stopFlush chan struct{}
+	flushDone chan struct{}
+}
+
+// limitedRegistry applies the rate limits of the receivers
+type limitedRegistry struct {
+	ReceiverRegistry
+	limiters map[string]*eventLimiter
+	limited  func()
+}
+
+func (r *limitedRegistry) SendEvent(name string, ev *kube.EnhancedEvent) {
+	if l := r.limiters[name]; l != nil && !l.allow(ev) {
+		r.limited()
+		return
+	}
+	r.ReceiverRegistry.SendEvent(name, ev)
 }
 
 func NewEngine(config *Config, registry ReceiverRegistry) *Engine {
@@ -28,19 +56,121 @@ func NewEngine(config *Config, registry ReceiverRegistry) *Engine {
 		registry.Register(v.Name, sink)
 	}
 
-	return &Engine{
+	e := &Engine{
 		Route:    config.Route,
 		Registry: registry,
 	}
+	e.groups = &groupingRegistry{ReceiverRegistry: registry, groupers: make(map[string]*eventGrouper), grouped: e.countGrouped}
+	e.receivers = &limitedRegistry{ReceiverRegistry: e.groups, limiters: make(map[string]*eventLimiter), limited: func() { e.countRateLimited(1) }}
+	for _, v := range config.Receivers {
+		if v.RateLimit != nil {
+			limiter, err := newEventLimiter(v.Name, *v.RateLimit)
+			if err != nil {
+				log.Fatal().Err(err).Str("name", v.Name).Msg("Cannot initialize rate limit")
+			}
+			e.receivers.limiters[v.Name] = limiter
+		}
+		if v.Group != nil {
+			grouper, err := newEventGrouper(v.Name, *v.Group)
+			if err != nil {
+				log.Fatal().Err(err).Str("name", v.Name).Msg("Cannot initialize grouping")
+			}
+			e.groups.groupers[v.Name] = grouper
+		}
+	}
+
+	if e.flushes() {
+		e.stopFlush = make(chan struct{})
+		e.flushDone = make(chan struct{})
+		go e.flushLoop()
+	}
+	return e
 }
 
 // OnEvent does not care whether event is add or update. Prior filtering should be done in the controller/watcher
 func (e *Engine) OnEvent(event *kube.EnhancedEvent) {
-	e.Route.ProcessEvent(event, e.Registry)
+	if e.Silences != nil && e.Silences.Silenced(event) {
+		if e.MetricsStore != nil {
+			e.MetricsStore.EventsSilenced.Inc()
+		}
+		return
+	}
+
+	result := e.Route.process(event, e.receivers)
+	if !result.routed() && e.MetricsStore != nil {
+		e.MetricsStore.EventsUnmatched.Inc()
+	}
+	e.countRateLimited(result.limited)
+}
+
+func (e *Engine) countRateLimited(n int) {
+	if n > 0 && e.MetricsStore != nil {
+		e.MetricsStore.EventsRateLimited.Add(float64(n))
+	}
+}
+
+func (e *Engine) countGrouped() {
+	if e.MetricsStore != nil {
+		e.MetricsStore.EventsGrouped.Inc()
+	}
+}
+
+// flushes returns true if there are rate limit summaries or group digests to send in the background
+func (e *Engine) flushes() bool {
+	if len(e.groups.groupers) > 0 || e.Route.summarizes() {
+		return true
+	}
+	for _, l := range e.receivers.limiters {
+		if l.limiter.Summarizes() {
+			return true
+		}
+	}
+	return false
+}
+
+// flushLoop sends the summaries of the rate limits and the digests of the groups once they are due
+func (e *Engine) flushLoop() {
+	defer close(e.flushDone)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush(false)
+		case <-e.stopFlush:
+			return
+		}
+	}
+}
+
+// flush sends the summaries of the rate limits and the digests of the groups that are due, or all of them if force
+// is set
+func (e *Engine) flush(force bool) {
+	count := e.Route.flushRateLimits(e.receivers, force)
+	for name, l := range e.receivers.limiters {
+		for _, ev := range l.summaries(force) {
+			e.groups.SendEvent(name, ev)
+			count++
+		}
+	}
+	digests := e.groups.flush(force)
+
+	if e.MetricsStore != nil {
+		e.MetricsStore.RateLimitSummaries.Add(float64(count))
+		e.MetricsStore.GroupDigests.Add(float64(digests))
+	}
 }
 
 // Stop stops all registered sinks
 func (e *Engine) Stop() {
+	if e.stopFlush != nil {
+		close(e.stopFlush)
+		<-e.flushDone
+		// The summaries and digests that are not due yet are sent before the sinks close
+		e.flush(true)
+	}
+
 	log.Info().Msg("Closing sinks")
 	e.Registry.Close()
 	log.Info().Msg("All sinks closed")
@@ -1,10 +1,18 @@
 package exporter
 
 import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestEngineNoRoutes(t *testing.T) {
@@ -63,3 +71,112 @@ func TestEngineDropSimple(t *testing.T) {
 	assert.NotContains(t, config.Ref.Events, ev)
 	assert.Empty(t, config.Ref.Events)
 }
+
+func TestEngineUnmatched(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	cfg := &Config{
+		Route: Route{
+			Match: []Rule{{
+				Namespace: "payments",
+				Receiver:  "in-mem",
+			}},
+		},
+		Receivers: []sinks.ReceiverConfig{{
+			Name:     "in-mem",
+			InMemory: &sinks.InMemoryConfig{},
+		}},
+	}
+
+	e := NewEngine(cfg, &SyncRegistry{})
+	e.MetricsStore = metricsStore
+
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "payments"
+	e.OnEvent(ev)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricsStore.EventsUnmatched))
+
+	ev = &kube.EnhancedEvent{}
+	ev.Namespace = "orders"
+	e.OnEvent(ev)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsStore.EventsUnmatched))
+}
+
+func TestEngineSilenced(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	config := &sinks.InMemoryConfig{}
+	cfg := &Config{
+		Route: Route{
+			Match: []Rule{{
+				Receiver: "in-mem",
+			}},
+		},
+		Receivers: []sinks.ReceiverConfig{{
+			Name:     "in-mem",
+			InMemory: config,
+		}},
+	}
+
+	e := NewEngine(cfg, &SyncRegistry{})
+	e.MetricsStore = metricsStore
+	e.Silences = NewSilences(SilencesConfig{Namespace: "monitoring"}, fake.NewSimpleClientset(), metricsStore)
+	silence, err := e.Silences.Create(context.Background(), Silence{
+		Match:  map[string]interface{}{"namespace": "shop"},
+		EndsAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "shop"
+	e.OnEvent(ev)
+	ev = &kube.EnhancedEvent{}
+	ev.Namespace = "orders"
+	e.OnEvent(ev)
+
+	require.Len(t, config.Ref.Events, 1)
+	assert.Equal(t, "orders", config.Ref.Events[0].Namespace)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsStore.EventsSilenced))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsStore.SilenceEvents.WithLabelValues(silence.ID)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricsStore.EventsUnmatched))
+}
+
+func TestEngineReceiverRateLimit(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	config := &sinks.InMemoryConfig{}
+	cfg := &Config{
+		Route: Route{
+			Match: []Rule{{
+				Receiver: "in-mem",
+			}},
+		},
+		Receivers: []sinks.ReceiverConfig{{
+			Name:      "in-mem",
+			InMemory:  config,
+			RateLimit: &ratelimit.Config{Limit: 1, Overflow: ratelimit.OverflowSummarize},
+		}},
+	}
+
+	e := NewEngine(cfg, &SyncRegistry{})
+	e.MetricsStore = metricsStore
+
+	for i := 0; i < 3; i++ {
+		ev := &kube.EnhancedEvent{}
+		ev.Reason = "FailedMount"
+		e.OnEvent(ev)
+	}
+	assert.Len(t, config.Ref.Events, 1)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricsStore.EventsRateLimited))
+	// Rate limited events are not unmatched
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricsStore.EventsUnmatched))
+
+	// Stopping sends the pending summaries
+	e.Stop()
+	require.Len(t, config.Ref.Events, 2)
+	assert.Equal(t, int32(2), config.Ref.Events[1].RateLimited)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsStore.RateLimitSummaries))
+}
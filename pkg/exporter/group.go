@@ -0,0 +1,175 @@
+package exporter
+
+import (
+	"bytes"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultGroupBy = "{{ .Namespace }}"
+
+type groupReasonKey struct {
+	reason, eventType string
+}
+
+type groupObjectKey struct {
+	kind, namespace, name string
+}
+
+// pendingGroup collects the events of a group until its next digest
+type pendingGroup struct {
+	first   *kube.EnhancedEvent
+	group   kube.EventGroup
+	reasons map[groupReasonKey]int
+	objects map[groupObjectKey]int
+	// due is when the next digest is sent, lastDigest when the previous one was sent
+	due        time.Time
+	lastDigest time.Time
+}
+
+func (g *pendingGroup) add(ev *kube.EnhancedEvent) {
+	if g.first == nil {
+		g.first = ev
+		g.reasons = make(map[groupReasonKey]int)
+		g.objects = make(map[groupObjectKey]int)
+	}
+	g.group.Count++
+
+	reason := groupReasonKey{reason: ev.Reason, eventType: ev.Type}
+	if i, ok := g.reasons[reason]; ok {
+		g.group.Reasons[i].Count++
+	} else {
+		g.reasons[reason] = len(g.group.Reasons)
+		g.group.Reasons = append(g.group.Reasons, kube.GroupReason{Reason: ev.Reason, Type: ev.Type, Count: 1})
+	}
+
+	object := groupObjectKey{kind: ev.InvolvedObject.Kind, namespace: ev.InvolvedObject.Namespace, name: ev.InvolvedObject.Name}
+	if i, ok := g.objects[object]; ok {
+		g.group.Objects[i].Count++
+	} else {
+		g.objects[object] = len(g.group.Objects)
+		g.group.Objects = append(g.group.Objects, kube.GroupObject{Kind: object.kind, Namespace: object.namespace, Name: object.name, Count: 1})
+	}
+}
+
+// digest returns a copy of the first event with the group and resets the group for the next digest
+func (g *pendingGroup) digest(now time.Time) *kube.EnhancedEvent {
+	ev := *g.first
+	group := g.group
+	ev.Group = &group
+
+	g.first = nil
+	g.group = kube.EventGroup{Key: group.Key}
+	g.lastDigest = now
+	return &ev
+}
+
+// eventGrouper collects the events of a receiver into groups and sends a digest per group
+type eventGrouper struct {
+	name     string
+	by       *template.Template
+	wait     time.Duration
+	interval time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*pendingGroup
+	now    func() time.Time
+}
+
+func newEventGrouper(name string, cfg sinks.GroupConfig) (*eventGrouper, error) {
+	by := cfg.By
+	if by == "" {
+		by = defaultGroupBy
+	}
+	tmpl, err := template.New("by").Funcs(sprig.TxtFuncMap()).Parse(by)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventGrouper{
+		name:     name,
+		by:       tmpl,
+		wait:     cfg.GetWait(),
+		interval: cfg.GetInterval(),
+		groups:   make(map[string]*pendingGroup),
+		now:      time.Now,
+	}, nil
+}
+
+// add puts the event into its group. A new group sends its first digest after the wait, a group that sent a digest
+// sends the next one an interval later.
+func (g *eventGrouper) add(ev *kube.EnhancedEvent) {
+	buf := new(bytes.Buffer)
+	if err := g.by.Execute(buf, ev); err != nil {
+		log.Debug().Err(err).Str("receiver", g.name).Msg("Cannot render group key")
+	}
+	key := buf.String()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	group, ok := g.groups[key]
+	if !ok {
+		group = &pendingGroup{group: kube.EventGroup{Key: key}, due: g.now().Add(g.wait)}
+		g.groups[key] = group
+	} else if group.first == nil {
+		group.due = group.lastDigest.Add(g.interval)
+	}
+	group.add(ev)
+}
+
+// flush returns the digests that are due, or all of them if force is set. Groups without events for an interval
+// after their last digest are forgotten, so that their next event waits again.
+func (g *eventGrouper) flush(force bool) []*kube.EnhancedEvent {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	var digests []*kube.EnhancedEvent
+	for key, group := range g.groups {
+		if group.first == nil {
+			if now.Sub(group.lastDigest) >= g.interval {
+				delete(g.groups, key)
+			}
+			continue
+		}
+		if force || !now.Before(group.due) {
+			digests = append(digests, group.digest(now))
+		}
+	}
+	return digests
+}
+
+// groupingRegistry hands the events of the receivers with grouping to their grouper instead of the registry
+type groupingRegistry struct {
+	ReceiverRegistry
+	groupers map[string]*eventGrouper
+	grouped  func()
+}
+
+func (r *groupingRegistry) SendEvent(name string, ev *kube.EnhancedEvent) {
+	if g := r.groupers[name]; g != nil {
+		g.add(ev)
+		r.grouped()
+		return
+	}
+	r.ReceiverRegistry.SendEvent(name, ev)
+}
+
+// flush sends the digests that are due, or all of them if force is set. It returns the number of digests.
+func (r *groupingRegistry) flush(force bool) int {
+	count := 0
+	for name, g := range r.groupers {
+		for _, ev := range g.flush(force) {
+			r.ReceiverRegistry.SendEvent(name, ev)
+			count++
+		}
+	}
+	return count
+}
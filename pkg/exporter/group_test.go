@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGroupedEvent(namespace, name, reason string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = namespace
+	ev.Type = "Warning"
+	ev.Reason = reason
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Namespace = namespace
+	ev.InvolvedObject.Name = name
+	return ev
+}
+
+func TestEventGrouper(t *testing.T) {
+	now := time.Now()
+	g, err := newEventGrouper("slack", sinks.GroupConfig{WaitSeconds: 30, IntervalSeconds: 300})
+	require.NoError(t, err)
+	g.now = func() time.Time { return now }
+
+	g.add(newGroupedEvent("default", "web-1", "BackOff"))
+	g.add(newGroupedEvent("default", "web-1", "BackOff"))
+	g.add(newGroupedEvent("default", "web-2", "FailedMount"))
+	g.add(newGroupedEvent("payments", "db-0", "BackOff"))
+
+	// Nothing is sent until the groups waited
+	assert.Empty(t, g.flush(false))
+	now = now.Add(30 * time.Second)
+	digests := g.flush(false)
+	require.Len(t, digests, 2)
+
+	var digest *kube.EnhancedEvent
+	for _, d := range digests {
+		if d.Group.Key == "default" {
+			digest = d
+		}
+	}
+	require.NotNil(t, digest)
+	assert.Equal(t, "web-1", digest.InvolvedObject.Name)
+	assert.Equal(t, &kube.EventGroup{
+		Key:     "default",
+		Count:   3,
+		Reasons: []kube.GroupReason{{Reason: "BackOff", Type: "Warning", Count: 2}, {Reason: "FailedMount", Type: "Warning", Count: 1}},
+		Objects: []kube.GroupObject{
+			{Kind: "Pod", Namespace: "default", Name: "web-1", Count: 2},
+			{Kind: "Pod", Namespace: "default", Name: "web-2", Count: 1},
+		},
+	}, digest.Group)
+
+	// New events of a group are sent an interval after the last digest
+	now = now.Add(time.Minute)
+	g.add(newGroupedEvent("default", "web-3", "BackOff"))
+	assert.Empty(t, g.flush(false))
+	now = now.Add(4 * time.Minute)
+	digests = g.flush(false)
+	require.Len(t, digests, 1)
+	assert.Equal(t, 1, digests[0].Group.Count)
+	assert.Equal(t, "web-3", digests[0].InvolvedObject.Name)
+
+	// Groups without events for an interval are forgotten, their next event waits again
+	now = now.Add(5 * time.Minute)
+	assert.Empty(t, g.flush(false))
+	assert.Empty(t, g.groups)
+	g.add(newGroupedEvent("default", "web-4", "BackOff"))
+	assert.Empty(t, g.flush(false))
+	assert.Len(t, g.flush(true), 1)
+}
+
+func TestEngineGrouping(t *testing.T) {
+	config := &sinks.InMemoryConfig{}
+	cfg := &Config{
+		Route: Route{
+			Match: []Rule{{
+				Receiver: "in-mem",
+			}},
+		},
+		Receivers: []sinks.ReceiverConfig{{
+			Name:     "in-mem",
+			InMemory: config,
+			Group:    &sinks.GroupConfig{By: "{{ .Reason }}"},
+		}},
+	}
+
+	e := NewEngine(cfg, &SyncRegistry{})
+	e.OnEvent(newGroupedEvent("default", "web-1", "BackOff"))
+	e.OnEvent(newGroupedEvent("default", "web-2", "BackOff"))
+	assert.Empty(t, config.Ref.Events)
+
+	// Stopping sends the digests that are not due yet
+	e.Stop()
+	require.Len(t, config.Ref.Events, 1)
+	assert.Equal(t, "BackOff", config.Ref.Events[0].Group.Key)
+	assert.Equal(t, 2, config.Ref.Events[0].Group.Count)
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Matcher is the structured form of a rule field. It is given as a mapping instead of a regular expression, all
+// conditions that are set must hold:
+//
+//	namespace:
+//	  notIn: [kube-system, kube-public]
+//	labels:
+//	  team:
+//	    exists: true
+//	  app:
+//	    equals: web
+//
+// Fields of the event that are empty and labels or annotations that are missing do not exist. The negations hold
+// for missing labels, like the NotIn operator of label selectors.
+type Matcher struct {
+	Match     string   `yaml:"match"`
+	NotMatch  string   `yaml:"notMatch"`
+	Equals    *string  `yaml:"equals"`
+	NotEquals *string  `yaml:"notEquals"`
+	In        []string `yaml:"in"`
+	NotIn     []string `yaml:"notIn"`
+	Exists    *bool    `yaml:"exists"`
+}
+
+// valueMatcher is the compiled form of a Matcher or of a plain regular expression
+type valueMatcher struct {
+	match     *regexp.Regexp
+	notMatch  *regexp.Regexp
+	equals    *string
+	notEquals *string
+	in        map[string]struct{}
+	notIn     map[string]struct{}
+	exists    *bool
+}
+
+func regexMatcher(pattern string) (*valueMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &valueMatcher{match: re}, nil
+}
+
+func (m Matcher) compile() (*valueMatcher, error) {
+	if m.Match == "" && m.NotMatch == "" && m.Equals == nil && m.NotEquals == nil && m.In == nil && m.NotIn == nil && m.Exists == nil {
+		return nil, errors.New("matcher has no condition")
+	}
+
+	compiled := &valueMatcher{equals: m.Equals, notEquals: m.NotEquals, exists: m.Exists}
+	var err error
+	if m.Match != "" {
+		if compiled.match, err = regexp.Compile(m.Match); err != nil {
+			return nil, fmt.Errorf("match: %w", err)
+		}
+	}
+	if m.NotMatch != "" {
+		if compiled.notMatch, err = regexp.Compile(m.NotMatch); err != nil {
+			return nil, fmt.Errorf("notMatch: %w", err)
+		}
+	}
+	if m.In != nil {
+		compiled.in = stringSet(m.In)
+	}
+	if m.NotIn != nil {
+		compiled.notIn = stringSet(m.NotIn)
+	}
+	return compiled, nil
+}
+
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+// matchesField matches a field of the event, an empty field does not exist
+func (m *valueMatcher) matchesField(value string) bool {
+	if m.exists != nil && *m.exists != (value != "") {
+		return false
+	}
+	return m.matchesValue(value)
+}
+
+// matchesKey matches an entry of a map of the event, e.g. a label
+func (m *valueMatcher) matchesKey(values map[string]string, key string) bool {
+	value, ok := values[key]
+	if m.exists != nil && *m.exists != ok {
+		return false
+	}
+	if !ok {
+		// Only negations and exists: false hold for a missing key
+		return m.match == nil && m.equals == nil && m.in == nil
+	}
+	return m.matchesValue(value)
+}
+
+func (m *valueMatcher) matchesValue(value string) bool {
+	if m.match != nil && !m.match.MatchString(value) {
+		return false
+	}
+	if m.notMatch != nil && m.notMatch.MatchString(value) {
+		return false
+	}
+	if m.equals != nil && value != *m.equals {
+		return false
+	}
+	if m.notEquals != nil && value == *m.notEquals {
+		return false
+	}
+	if m.in != nil {
+		if _, ok := m.in[value]; !ok {
+			return false
+		}
+	}
+	if m.notIn != nil {
+		if _, ok := m.notIn[value]; ok {
+			return false
+		}
+	}
+	return true
+}
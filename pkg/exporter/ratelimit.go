@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+// eventLimiter rate limits events by the key template of its config
+type eventLimiter struct {
+	name    string
+	key     *template.Template
+	limiter *ratelimit.Limiter
+}
+
+func newEventLimiter(name string, cfg ratelimit.Config) (*eventLimiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := template.New("key").Funcs(sprig.TxtFuncMap()).Parse(cfg.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	return &eventLimiter{name: name, key: key, limiter: ratelimit.New(cfg)}, nil
+}
+
+// allow returns false if the event is over the limit of its key. Events whose key cannot be rendered are allowed.
+func (l *eventLimiter) allow(ev *kube.EnhancedEvent) bool {
+	buf := new(bytes.Buffer)
+	if err := l.key.Execute(buf, ev); err != nil {
+		log.Debug().Err(err).Str("limiter", l.name).Msg("Cannot render rate limit key")
+		return true
+	}
+	return l.limiter.Allow(buf.String(), ev)
+}
+
+// summaries returns a copy of the last dropped event of each key that is due for a summary, with the number of
+// dropped events in RateLimited
+func (l *eventLimiter) summaries(force bool) []*kube.EnhancedEvent {
+	var events []*kube.EnhancedEvent
+	for _, s := range l.limiter.Flush(force) {
+		ev := *s.Last.(*kube.EnhancedEvent)
+		ev.RateLimited = int32(s.Suppressed)
+		events = append(events, &ev)
+	}
+	return events
+}
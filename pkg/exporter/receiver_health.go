@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+)
+
+const (
+	receiversHealthName = "receivers"
+	// A receiver is failing after receiverFailingErrors sends in a row failed, until receiverFailingWindow passed since
+	// the last error. A single rejected send, e.g. a rate limit, does not make it fail, and a quiet cluster without
+	// sends does not keep it failing.
+	receiverFailingErrors = 3
+	receiverFailingWindow = 5 * time.Minute
+)
+
+// receiverHealth tracks the sends of a receiver for the health endpoints
+type receiverHealth struct {
+	mu                sync.Mutex
+	sendingSince      time.Time
+	lastSuccess       time.Time
+	lastError         time.Time
+	lastErrorMessage  string
+	sends             int64
+	errors            int64
+	consecutiveErrors int64
+}
+
+type receiverStatus struct {
+	Healthy           bool       `json:"healthy"`
+	Sending           bool       `json:"sending"`
+	LastSuccess       *time.Time `json:"lastSuccess,omitempty"`
+	LastError         *time.Time `json:"lastError,omitempty"`
+	LastErrorMessage  string     `json:"lastErrorMessage,omitempty"`
+	Sends             int64      `json:"sends"`
+	Errors            int64      `json:"errors"`
+	ConsecutiveErrors int64      `json:"consecutiveErrors"`
+}
+
+func (h *receiverHealth) sending() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendingSince = time.Now()
+}
+
+func (h *receiverHealth) sent(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sendingSince = time.Time{}
+	h.sends++
+	if err != nil {
+		h.lastError = time.Now()
+		h.lastErrorMessage = err.Error()
+		h.errors++
+		h.consecutiveErrors++
+		return
+	}
+	h.lastSuccess = time.Now()
+	h.consecutiveErrors = 0
+}
+
+func (h *receiverHealth) failing() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.isFailing(time.Now())
+}
+
+func (h *receiverHealth) isFailing(now time.Time) bool {
+	return h.consecutiveErrors >= receiverFailingErrors && now.Sub(h.lastError) < receiverFailingWindow
+}
+
+func (h *receiverHealth) status() receiverStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := receiverStatus{
+		Healthy:           !h.isFailing(time.Now()),
+		Sending:           !h.sendingSince.IsZero(),
+		LastErrorMessage:  h.lastErrorMessage,
+		Sends:             h.sends,
+		Errors:            h.errors,
+		ConsecutiveErrors: h.consecutiveErrors,
+	}
+	if !h.lastSuccess.IsZero() {
+		lastSuccess := h.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	if !h.lastError.IsZero() {
+		lastError := h.lastError
+		status.LastError = &lastError
+	}
+	return status
+}
+
+func (r *ChannelBasedReceiverRegistry) registerHealth() {
+	metrics.RegisterReadinessCheck(receiversHealthName, r.checkReady)
+	metrics.RegisterLivenessCheck(receiversHealthName, r.busySince)
+	metrics.RegisterStatus(receiversHealthName, r.status)
+}
+
+// checkReady fails if every receiver is failing. A single failing receiver does not affect the others, so it does not
+// make the exporter unready.
+func (r *ChannelBasedReceiverRegistry) checkReady() error {
+	r.healthMu.RLock()
+	defer r.healthMu.RUnlock()
+
+	if len(r.health) == 0 {
+		return nil
+	}
+	for _, h := range r.health {
+		if !h.failing() {
+			return nil
+		}
+	}
+	return errors.New("all receivers are failing")
+}
+
+// busySince returns since when the longest running send is in progress
+func (r *ChannelBasedReceiverRegistry) busySince() time.Time {
+	r.healthMu.RLock()
+	defer r.healthMu.RUnlock()
+
+	var since time.Time
+	for _, h := range r.health {
+		h.mu.Lock()
+		if !h.sendingSince.IsZero() && (since.IsZero() || h.sendingSince.Before(since)) {
+			since = h.sendingSince
+		}
+		h.mu.Unlock()
+	}
+	return since
+}
+
+func (r *ChannelBasedReceiverRegistry) status() interface{} {
+	r.healthMu.RLock()
+	defer r.healthMu.RUnlock()
+
+	statuses := make(map[string]receiverStatus, len(r.health))
+	for name, h := range r.health {
+		statuses[name] = h.status()
+	}
+	return statuses
+}
@@ -1,6 +1,11 @@
 package exporter
 
-import "github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+import (
+	"fmt"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
+)
 
 // Route allows using rules to drop events or match events to specific receivers.
 // It also allows using routes recursively for complex route building to fit
@@ -9,22 +14,71 @@ type Route struct {
 	Drop   []Rule
 	Match  []Rule
 	Routes []Route
+	// Continue controls whether the next sub routes of the parent get an event this route sent to a receiver,
+	// defaults to true. Setting it to false makes the first sub route that matches win.
+	Continue *bool `yaml:"continue"`
+	// DefaultReceiver gets the events that match all rules of the route but are neither dropped nor sent to a receiver
+	// by the route or its sub routes
+	DefaultReceiver string `yaml:"defaultReceiver"`
+	// RateLimit limits the events that pass the drop rules of the route, it takes effect once the route is compiled
+	RateLimit *ratelimit.Config `yaml:"rateLimit"`
+
+	limiter *eventLimiter
+}
+
+// routeResult tells what a route did with an event
+type routeResult struct {
+	// matched is true if a rule sent the event to a receiver
+	matched bool
+	// dropped is true if a drop rule matched the event
+	dropped bool
+	// sent is true if the event was sent to a receiver, either by a rule or as a default
+	sent bool
+	// limited is the number of rate limits the event exceeded
+	limited int
+}
+
+// ProcessEvent sends the event to the receivers of the matching rules. It returns false if the event matched no rule,
+// i.e. it was neither dropped, rate limited nor sent to a receiver other than a default receiver.
+func (r *Route) ProcessEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry) bool {
+	return r.process(ev, registry).routed()
+}
+
+func (r routeResult) routed() bool {
+	return r.matched || r.dropped || r.limited > 0
 }
 
-func (r *Route) ProcessEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry) {
+func (r *Route) process(ev *kube.EnhancedEvent, registry ReceiverRegistry) routeResult {
+	var result routeResult
+
 	// First determine whether we will drop the event: If any of the drop is matched, we break the loop
-	for _, v := range r.Drop {
-		if v.MatchesEvent(ev) {
-			return
+	for i := range r.Drop {
+		if r.Drop[i].MatchesEvent(ev) {
+			result.dropped = true
+			return result
 		}
 	}
 
-	// It has match rules, it should go to the matchers
+	if r.limiter != nil && !r.limiter.allow(ev) {
+		result.limited++
+		return result
+	}
+	return r.route(ev, registry)
+}
+
+// route sends an event that passed the drop rules and the rate limit to the receivers
+func (r *Route) route(ev *kube.EnhancedEvent, registry ReceiverRegistry) routeResult {
+	var result routeResult
+
+	// It has match rules, it should go to the matchers. The rules are not copied, they are too big for the hot path.
 	matchesAll := true
-	for _, rule := range r.Match {
+	for i := range r.Match {
+		rule := &r.Match[i]
 		if rule.MatchesEvent(ev) {
 			if rule.Receiver != "" {
 				registry.SendEvent(rule.Receiver, ev)
+				result.matched = true
+				result.sent = true
 				// Send the event down the hole
 			}
 		} else {
@@ -34,8 +88,83 @@ func (r *Route) ProcessEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry)
 
 	// If all matches are satisfied, we can send them down to the rabbit hole
 	if matchesAll {
-		for _, subRoute := range r.Routes {
-			subRoute.ProcessEvent(ev, registry)
+		for i := range r.Routes {
+			route := &r.Routes[i]
+			sub := route.process(ev, registry)
+			result.matched = result.matched || sub.matched
+			result.dropped = result.dropped || sub.dropped
+			result.sent = result.sent || sub.sent
+			result.limited += sub.limited
+			if sub.sent && !route.continues() {
+				break
+			}
+		}
+	}
+
+	if matchesAll && !result.sent && !result.dropped && result.limited == 0 && r.DefaultReceiver != "" {
+		registry.SendEvent(r.DefaultReceiver, ev)
+		result.sent = true
+	}
+	return result
+}
+
+func (r *Route) continues() bool {
+	return r.Continue == nil || *r.Continue
+}
+
+// flushRateLimits routes the summaries of the rate limits of the route and its sub routes that are due, or all of
+// them if force is set. It returns the number of summaries.
+func (r *Route) flushRateLimits(registry ReceiverRegistry, force bool) int {
+	count := 0
+	if r.limiter != nil {
+		for _, ev := range r.limiter.summaries(force) {
+			r.route(ev, registry)
+			count++
+		}
+	}
+	for i := range r.Routes {
+		count += r.Routes[i].flushRateLimits(registry, force)
+	}
+	return count
+}
+
+// summarizes returns true if the route or one of its sub routes summarizes the events over its rate limit
+func (r *Route) summarizes() bool {
+	if r.limiter != nil && r.limiter.limiter.Summarizes() {
+		return true
+	}
+	for i := range r.Routes {
+		if r.Routes[i].summarizes() {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile compiles the rules of the route and its sub routes and sets up their rate limits. The error names the path
+// of the invalid rule, starting with the given path of the route, e.g. route.routes[0].match[1].labels.app
+func (r *Route) Compile(path string) error {
+	if r.RateLimit != nil {
+		limiter, err := newEventLimiter(path, *r.RateLimit)
+		if err != nil {
+			return fmt.Errorf("%s.rateLimit: %w", path, err)
+		}
+		r.limiter = limiter
+	}
+	for i := range r.Drop {
+		if err := r.Drop[i].Compile(); err != nil {
+			return fmt.Errorf("%s.drop[%d].%w", path, i, err)
+		}
+	}
+	for i := range r.Match {
+		if err := r.Match[i].Compile(); err != nil {
+			return fmt.Errorf("%s.match[%d].%w", path, i, err)
+		}
+	}
+	for i := range r.Routes {
+		if err := r.Routes[i].Compile(fmt.Sprintf("%s.routes[%d]", path, i)); err != nil {
+			return err
 		}
 	}
+	return nil
 }
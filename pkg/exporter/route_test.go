@@ -1,10 +1,13 @@
 package exporter
 
 import (
+	"testing"
+
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/sinks"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
 // testReceiverRegistry just records the events to the registry so that tests can validate routing behavior
@@ -223,3 +226,242 @@ func Test_GHIssue51(t *testing.T) {
 	assert.True(t, reg.isEventRcvd("elastic", &ev1))
 	assert.False(t, reg.isEventRcvd("elastic", &ev2))
 }
+
+func TestRouteContinue(t *testing.T) {
+	ev := kube.EnhancedEvent{}
+	ev.Namespace = "payments"
+	reg := testReceiverRegistry{}
+
+	stop := false
+	r := Route{
+		Routes: []Route{{
+			Match: []Rule{{
+				Namespace: "payments",
+				Receiver:  "payments-team",
+			}},
+			Continue: &stop,
+		}, {
+			Match: []Rule{{
+				Receiver: "everything",
+			}},
+		}},
+	}
+
+	assert.True(t, r.ProcessEvent(&ev, &reg))
+	assert.True(t, reg.isEventRcvd("payments-team", &ev))
+	assert.False(t, reg.isEventRcvd("everything", &ev))
+
+	// A route that does not send the event lets the next one have it
+	other := kube.EnhancedEvent{}
+	other.Namespace = "orders"
+	assert.True(t, r.ProcessEvent(&other, &reg))
+	assert.False(t, reg.isEventRcvd("payments-team", &other))
+	assert.True(t, reg.isEventRcvd("everything", &other))
+}
+
+func TestRouteDefaultReceiver(t *testing.T) {
+	reg := testReceiverRegistry{}
+
+	r := Route{
+		Drop: []Rule{{
+			Type: "Normal",
+		}},
+		Routes: []Route{{
+			Match: []Rule{{
+				Namespace: "payments",
+				Receiver:  "payments-team",
+			}},
+		}},
+		DefaultReceiver: "fallback",
+	}
+
+	matched := kube.EnhancedEvent{}
+	matched.Namespace = "payments"
+	assert.True(t, r.ProcessEvent(&matched, &reg))
+	assert.False(t, reg.isEventRcvd("fallback", &matched))
+
+	unmatched := kube.EnhancedEvent{}
+	unmatched.Namespace = "orders"
+	assert.False(t, r.ProcessEvent(&unmatched, &reg))
+	assert.True(t, reg.isEventRcvd("fallback", &unmatched))
+
+	// Dropped events do not go to the default receiver
+	dropped := kube.EnhancedEvent{}
+	dropped.Type = "Normal"
+	assert.True(t, r.ProcessEvent(&dropped, &reg))
+	assert.False(t, reg.isEventRcvd("fallback", &dropped))
+}
+
+func TestRouteDefaultReceiver_SubRoute(t *testing.T) {
+	reg := testReceiverRegistry{}
+
+	stop := false
+	r := Route{
+		Routes: []Route{{
+			Match: []Rule{{
+				Namespace: "payments",
+			}},
+			Routes: []Route{{
+				Match: []Rule{{
+					Reason:   "Failed",
+					Receiver: "payments-failures",
+				}},
+			}},
+			Continue:        &stop,
+			DefaultReceiver: "payments-team",
+		}, {
+			Match: []Rule{{
+				Receiver: "everything",
+			}},
+		}},
+	}
+
+	payments := kube.EnhancedEvent{}
+	payments.Namespace = "payments"
+	assert.False(t, r.ProcessEvent(&payments, &reg))
+	assert.True(t, reg.isEventRcvd("payments-team", &payments))
+	assert.False(t, reg.isEventRcvd("everything", &payments))
+
+	// Events the sub route does not match skip its default receiver and go on to the next sub route
+	orders := kube.EnhancedEvent{}
+	orders.Namespace = "orders"
+	assert.True(t, r.ProcessEvent(&orders, &reg))
+	assert.False(t, reg.isEventRcvd("payments-team", &orders))
+	assert.True(t, reg.isEventRcvd("everything", &orders))
+}
+
+func TestRouteRateLimit(t *testing.T) {
+	reg := testReceiverRegistry{}
+
+	r := Route{
+		Routes: []Route{{
+			Match: []Rule{{
+				Receiver: "slack",
+			}},
+			RateLimit: &ratelimit.Config{Limit: 2, Key: "{{ .InvolvedObject.Name }}/{{ .Reason }}", Overflow: ratelimit.OverflowSummarize},
+		}},
+		DefaultReceiver: "fallback",
+	}
+	require.NoError(t, r.Compile("route"))
+
+	newEvent := func(name string) *kube.EnhancedEvent {
+		ev := &kube.EnhancedEvent{}
+		ev.InvolvedObject.Name = name
+		ev.Reason = "FailedMount"
+		return ev
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, r.ProcessEvent(newEvent("web"), &reg))
+	}
+	assert.True(t, r.ProcessEvent(newEvent("db"), &reg))
+	assert.Equal(t, 3, reg.count("slack"))
+	// Limited events do not go to the default receiver
+	assert.Equal(t, 0, reg.count("fallback"))
+
+	// The summary goes to the receivers of the route with the number of limited events
+	assert.Equal(t, 1, r.flushRateLimits(&reg, true))
+	require.Equal(t, 4, reg.count("slack"))
+	assert.Equal(t, int32(3), reg.rcvd["slack"][3].RateLimited)
+	assert.Equal(t, "web", reg.rcvd["slack"][3].InvolvedObject.Name)
+}
+
+func TestRouteCompile(t *testing.T) {
+	r := Route{
+		Match: []Rule{{
+			Namespace: "kube-*",
+		}},
+		Routes: []Route{{
+			Match: []Rule{{
+				Receiver: "osman",
+			}},
+		}, {
+			Drop: []Rule{{
+				Type: "Normal",
+			}},
+			Match: []Rule{{
+				Reason: "BackOff",
+			}, {
+				Labels:   map[string]string{"app": "web-(", "team": "payments"},
+				Receiver: "any",
+			}},
+		}},
+	}
+
+	err := r.Compile("route")
+	assert.EqualError(t, err, "route.routes[1].match[1].labels.app: error parsing regexp: missing closing ): `web-(`")
+
+	r.Routes[1].RateLimit = &ratelimit.Config{Limit: 1, Key: "{{ .Reason"}
+	assert.ErrorContains(t, r.Compile("route"), "route.routes[1].rateLimit: template: key:1: unclosed action")
+	r.Routes[1].RateLimit = nil
+
+	r.Routes[1].Match[1].Labels["app"] = "web-.*"
+	assert.NoError(t, r.Compile("route"))
+	assert.NotNil(t, r.Routes[1].Match[1].compiled)
+	assert.Len(t, r.Routes[1].Match[1].compiled.maps, 2)
+}
+
+// discardRegistry drops all events, so that benchmarks only measure the routing
+type discardRegistry struct{}
+
+func (discardRegistry) Register(string, sinks.Sink) {}
+
+func (discardRegistry) SendEvent(string, *kube.EnhancedEvent) {}
+
+func (discardRegistry) Close() {}
+
+func BenchmarkRoute_ProcessEvent(b *testing.B) {
+	newRoute := func() Route {
+		return Route{
+			Drop: []Rule{{
+				Namespace: "kube-system|kube-public",
+			}, {
+				Type:   "Normal",
+				Reason: "Scheduled|Pulled|Created|Started",
+			}},
+			Match: []Rule{{
+				Receiver: "dump",
+			}},
+			Routes: []Route{{
+				Match: []Rule{{
+					Kind:     "Pod|Deployment|ReplicaSet",
+					Labels:   map[string]string{"team": "payments|checkout"},
+					Receiver: "slack",
+				}, {
+					Reason:   "BackOff|CrashLoopBackOff|OOMKilled",
+					Message:  ".*(exit code|out of memory).*",
+					Receiver: "opsgenie",
+				}},
+			}},
+		}
+	}
+
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "payments"
+	ev.Type = "Warning"
+	ev.Reason = "BackOff"
+	ev.Message = "Back-off restarting failed container, exit code 1"
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Labels = map[string]string{"team": "payments", "app": "web"}
+
+	b.Run("compiled", func(b *testing.B) {
+		r := newRoute()
+		if err := r.Compile("route"); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			r.ProcessEvent(ev, discardRegistry{})
+		}
+	})
+
+	b.Run("uncompiled", func(b *testing.B) {
+		r := newRoute()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			r.ProcessEvent(ev, discardRegistry{})
+		}
+	})
+}
@@ -1,19 +1,15 @@
 package exporter
 
 import (
-	"regexp"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
 
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
 )
 
-// matchString is a method to clean the code. Error handling is omitted here because these
-// rules are validated before use. According to regexp.MatchString, the only way it fails its
-// that the pattern does not compile.
-func matchString(pattern, s string) bool {
-	matched, _ := regexp.MatchString(pattern, s)
-	return matched
-}
-
 // Rule is for matching an event
 type Rule struct {
 	Labels      map[string]string
@@ -27,60 +23,142 @@ type Rule struct {
 	MinCount    int32 `yaml:"minCount"`
 	Component   string
 	Host        string
-	Receiver    string
+	Occurrence  string
+	// ReportingController, ReportingInstance and Action are mostly set by the events.k8s.io/v1 API
+	ReportingController string `yaml:"reportingController"`
+	ReportingInstance   string `yaml:"reportingInstance"`
+	Action              string
+	Cluster             string
+	// OwnerKind, OwnerName and OwnerLabels match the top level owner, they require ownerChain to be enabled
+	OwnerKind   string            `yaml:"ownerKind"`
+	OwnerName   string            `yaml:"ownerName"`
+	OwnerLabels map[string]string `yaml:"ownerLabels"`
+	// NamespaceLabels and NamespaceAnnotations require enrichment.namespace to be enabled
+	NamespaceLabels      map[string]string `yaml:"namespaceLabels"`
+	NamespaceAnnotations map[string]string `yaml:"namespaceAnnotations"`
+	// Node, Zone, Region and InstanceType match the node of Pod and Node events, they require enrichment.node
+	// to be enabled
+	Node         string
+	Zone         string
+	Region       string
+	InstanceType string `yaml:"instanceType"`
+	Receiver     string
+	// Fields matches arbitrary fields of the serialized event, the keys are JSONPath expressions like
+	// .involvedObject.fieldPath and the values regular expressions
+	Fields map[string]string
+	// Expr is a Common Expression Language expression on the event, e.g. event.count > 3
+	Expr string
+
+	// Matchers holds the fields given as a mapping instead of a regular expression, see Matcher. They are keyed by the
+	// name of the field, e.g. namespace, or by the name of the map and the key, e.g. labels.app.
+	Matchers map[string]Matcher `yaml:"-"`
+
+	// compiled holds the regular expressions of the rule, see Compile
+	compiled *compiledRule
+}
+
+// UnmarshalYAML accepts a mapping in place of the regular expression of a field, or of a label or annotation
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	return r.decode(raw)
+}
+
+// decode fills the rule from a decoded mapping, the options apply to the fields given as plain values. It removes the
+// fields given as a mapping from raw.
+func (r *Rule) decode(raw map[string]interface{}, opts ...yaml.DecodeOption) error {
+	matchers := make(map[string]Matcher)
+	for i := range ruleFields {
+		name := ruleFields[i].name
+		if value, ok := raw[name].(map[string]interface{}); ok {
+			if err := decodeMatcher(value, name, matchers); err != nil {
+				return err
+			}
+			delete(raw, name)
+		}
+	}
+	for i := range ruleMapFields {
+		name := ruleMapFields[i].name
+		values, ok := raw[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range values {
+			if value, ok := value.(map[string]interface{}); ok {
+				if err := decodeMatcher(value, name+"."+key, matchers); err != nil {
+					return err
+				}
+				delete(values, key)
+			}
+		}
+	}
+
+	// The remaining fields are plain values
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	type plainRule Rule
+	if err := yaml.UnmarshalWithOptions(b, (*plainRule)(r), opts...); err != nil {
+		return err
+	}
+	if len(matchers) > 0 {
+		r.Matchers = matchers
+	}
+	return nil
+}
+
+func decodeMatcher(value map[string]interface{}, name string, matchers map[string]Matcher) error {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var m Matcher
+	if err := yaml.UnmarshalWithOptions(b, &m, yaml.DisallowUnknownField()); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	matchers[name] = m
+	return nil
 }
 
 // MatchesEvent compares the rule to an event and returns a boolean value to indicate
 // whether the event is compatible with the rule. All fields are compared as regular expressions
 // so the user must keep that in mind while writing rules.
 func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
+	compiled := r.compiled
+	if compiled == nil {
+		// Rules that did not go through the config validation, an invalid pattern never matches
+		var err error
+		if compiled, err = r.compile(); err != nil {
+			return false
+		}
+	}
+
 	// These rules are just basic comparison rules, if one of them fails, it means the event does not match the rule
-	rules := [][2]string{
-		{r.Message, ev.Message},
-		{r.APIVersion, ev.InvolvedObject.APIVersion},
-		{r.Kind, ev.InvolvedObject.Kind},
-		{r.Namespace, ev.Namespace},
-		{r.Reason, ev.Reason},
-		{r.Type, ev.Type},
-		{r.Component, ev.Source.Component},
-		{r.Host, ev.Source.Host},
-	}
-
-	for _, v := range rules {
-		rule := v[0]
-		value := v[1]
-		if rule != "" {
-			matches := matchString(rule, value)
-			if !matches {
-				return false
-			}
+	for _, m := range compiled.fields {
+		if !m.matches(ev) {
+			return false
 		}
 	}
 
-	// Labels are also mutually exclusive, they all need to be present
-	if r.Labels != nil && len(r.Labels) > 0 {
-		for k, v := range r.Labels {
-			if val, ok := ev.InvolvedObject.Labels[k]; !ok {
-				return false
-			} else {
-				matches := matchString(v, val)
-				if !matches {
-					return false
-				}
-			}
+	// Labels, annotations and the like are also mutually exclusive, they all need to be present unless the matcher
+	// allows them to be missing
+	for _, m := range compiled.maps {
+		if !m.matches(ev) {
+			return false
 		}
 	}
 
-	// Annotations are also mutually exclusive, they all need to be present
-	if r.Annotations != nil && len(r.Annotations) > 0 {
-		for k, v := range r.Annotations {
-			if val, ok := ev.InvolvedObject.Annotations[k]; !ok {
+	if len(compiled.paths) > 0 {
+		obj, err := eventObject(ev)
+		if err != nil {
+			return false
+		}
+		for _, m := range compiled.paths {
+			if !m.matches(obj) {
 				return false
-			} else {
-				matches := matchString(v, val)
-				if !matches {
-					return false
-				}
 			}
 		}
 	}
@@ -90,6 +168,127 @@ func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
 		return false
 	}
 
+	// The expression is evaluated last, it is the most expensive check
+	if compiled.expr != nil && !matchesExpr(compiled.expr, ev) {
+		return false
+	}
+
 	// If it failed every step, it must match because our matchers are limiting
 	return true
 }
+
+// Compile compiles the regular expressions of the rule once, so that they are not compiled again for every event.
+// The error names the field with the invalid pattern.
+func (r *Rule) Compile() error {
+	compiled, err := r.compile()
+	if err != nil {
+		return err
+	}
+	r.compiled = compiled
+	return nil
+}
+
+func (r *Rule) compile() (*compiledRule, error) {
+	compiled := &compiledRule{}
+	known := 0
+	for i := range ruleFields {
+		field := &ruleFields[i]
+		if pattern := field.pattern(r); pattern != "" {
+			matcher, err := regexMatcher(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.name, err)
+			}
+			compiled.fields = append(compiled.fields, fieldMatcher{field: field, matcher: matcher})
+		}
+
+		if m, ok := r.Matchers[field.name]; ok {
+			known++
+			matcher, err := m.compile()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.name, err)
+			}
+			compiled.fields = append(compiled.fields, fieldMatcher{field: field, matcher: matcher})
+		}
+	}
+
+	for i := range ruleMapFields {
+		field := &ruleMapFields[i]
+		patterns := field.patterns(r)
+		// Sorted so that the error for a rule with several invalid patterns is always the same
+		keys := make([]string, 0, len(patterns))
+		for k := range patterns {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			matcher, err := regexMatcher(patterns[k])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", field.name, k, err)
+			}
+			compiled.maps = append(compiled.maps, mapMatcher{field: field, key: k, matcher: matcher})
+		}
+
+		prefix := field.name + "."
+		names := make([]string, 0)
+		for name := range r.Matchers {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			known++
+			matcher, err := r.Matchers[name].compile()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			compiled.maps = append(compiled.maps, mapMatcher{field: field, key: strings.TrimPrefix(name, prefix), matcher: matcher})
+		}
+	}
+
+	paths := make([]string, 0, len(r.Fields))
+	for path := range r.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		matcher, err := newPathMatcher(path, r.Fields[path])
+		if err != nil {
+			return nil, fmt.Errorf("fields[%s]: %w", path, err)
+		}
+		compiled.paths = append(compiled.paths, matcher)
+	}
+
+	if r.Expr != "" {
+		expr, err := compileExpr(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("expr: %w", err)
+		}
+		compiled.expr = expr
+	}
+
+	if known != len(r.Matchers) {
+		for name := range r.Matchers {
+			if !isMatcherName(name) {
+				return nil, fmt.Errorf("%s: unknown field", name)
+			}
+		}
+	}
+	return compiled, nil
+}
+
+func isMatcherName(name string) bool {
+	for i := range ruleFields {
+		if ruleFields[i].name == name {
+			return true
+		}
+	}
+	for i := range ruleMapFields {
+		if strings.HasPrefix(name, ruleMapFields[i].name+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package exporter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/rs/zerolog/log"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// eventTypeName is the CEL type of the event variable of rule expressions
+const eventTypeName = "kubernetes_event_exporter.Event"
+
+// eventTypeProvider declares the fields of the event variable, they are the rule fields along with the name of the
+// involved object and the count. Fields are read from the EnhancedEvent directly, the event is not converted.
+type eventTypeProvider struct {
+	ref.TypeProvider
+	fields map[string]*ref.FieldType
+}
+
+func newEventTypeProvider() (*eventTypeProvider, error) {
+	registry, err := types.NewRegistry()
+	if err != nil {
+		return nil, err
+	}
+	p := &eventTypeProvider{TypeProvider: registry, fields: make(map[string]*ref.FieldType)}
+
+	stringType, err := cel.TypeToExprType(cel.StringType)
+	if err != nil {
+		return nil, err
+	}
+	mapType, err := cel.TypeToExprType(cel.MapType(cel.StringType, cel.StringType))
+	if err != nil {
+		return nil, err
+	}
+	intType, err := cel.TypeToExprType(cel.IntType)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ruleFields {
+		field := &ruleFields[i]
+		p.add(field.name, stringType, func(ev *kube.EnhancedEvent) interface{} { return field.value(ev) })
+	}
+	for i := range ruleMapFields {
+		field := &ruleMapFields[i]
+		p.add(field.name, mapType, func(ev *kube.EnhancedEvent) interface{} {
+			if values := field.values(ev); values != nil {
+				return values
+			}
+			return map[string]string{}
+		})
+	}
+	p.add("name", stringType, func(ev *kube.EnhancedEvent) interface{} { return ev.InvolvedObject.Name })
+	p.add("count", intType, func(ev *kube.EnhancedEvent) interface{} { return int64(ev.Count) })
+	return p, nil
+}
+
+func (p *eventTypeProvider) add(name string, t *exprpb.Type, get func(ev *kube.EnhancedEvent) interface{}) {
+	p.fields[name] = &ref.FieldType{
+		Type: t,
+		IsSet: func(target interface{}) bool {
+			_, ok := target.(*kube.EnhancedEvent)
+			return ok
+		},
+		GetFrom: func(target interface{}) (interface{}, error) {
+			ev, ok := target.(*kube.EnhancedEvent)
+			if !ok {
+				return nil, fmt.Errorf("unexpected event type %T", target)
+			}
+			return get(ev), nil
+		},
+	}
+}
+
+func (p *eventTypeProvider) FindType(typeName string) (*exprpb.Type, bool) {
+	if typeName == eventTypeName {
+		return decls.NewTypeType(decls.NewObjectType(eventTypeName)), true
+	}
+	return p.TypeProvider.FindType(typeName)
+}
+
+func (p *eventTypeProvider) FindFieldType(messageType string, fieldName string) (*ref.FieldType, bool) {
+	if messageType == eventTypeName {
+		field, ok := p.fields[fieldName]
+		return field, ok
+	}
+	return p.TypeProvider.FindFieldType(messageType, fieldName)
+}
+
+var (
+	exprEnvOnce sync.Once
+	exprEnv     *cel.Env
+	exprEnvErr  error
+)
+
+func eventExprEnv() (*cel.Env, error) {
+	exprEnvOnce.Do(func() {
+		var provider *eventTypeProvider
+		provider, exprEnvErr = newEventTypeProvider()
+		if exprEnvErr != nil {
+			return
+		}
+		exprEnv, exprEnvErr = cel.NewEnv(
+			cel.CustomTypeProvider(provider),
+			cel.Variable("event", cel.ObjectType(eventTypeName)),
+		)
+	})
+	return exprEnv, exprEnvErr
+}
+
+// compileExpr parses and type checks a rule expression, it must evaluate to a bool
+func compileExpr(expr string) (cel.Program, error) {
+	env, err := eventExprEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.ResultType().GetPrimitive() != exprpb.Type_BOOL {
+		return nil, fmt.Errorf("must evaluate to a bool, not %s", ast.OutputType())
+	}
+	return env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+}
+
+// eventActivation resolves the event variable without building a map for every evaluation
+type eventActivation struct {
+	ev *kube.EnhancedEvent
+}
+
+func (a eventActivation) ResolveName(name string) (interface{}, bool) {
+	if name == "event" {
+		return a.ev, true
+	}
+	return nil, false
+}
+
+func (a eventActivation) Parent() interpreter.Activation {
+	return nil
+}
+
+// matchesExpr evaluates a rule expression, an expression that fails to evaluate does not match
+func matchesExpr(prg cel.Program, ev *kube.EnhancedEvent) bool {
+	out, _, err := prg.Eval(eventActivation{ev: ev})
+	if err != nil {
+		log.Debug().Err(err).Str("event", ev.Message).Msg("Cannot evaluate rule expression")
+		return false
+	}
+	return out == types.True
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ruleField is a field of the event that a rule matches with a single pattern
+type ruleField struct {
+	name    string
+	pattern func(r *Rule) string
+	value   func(ev *kube.EnhancedEvent) string
+}
+
+// ruleMapField is a map of the event, e.g. the labels, that a rule matches with a pattern per key
+type ruleMapField struct {
+	name     string
+	patterns func(r *Rule) map[string]string
+	values   func(ev *kube.EnhancedEvent) map[string]string
+}
+
+type fieldMatcher struct {
+	field   *ruleField
+	matcher *valueMatcher
+}
+
+type mapMatcher struct {
+	field   *ruleMapField
+	key     string
+	matcher *valueMatcher
+}
+
+// pathMatcher matches the values a JSONPath finds in the serialized event. JSONPath keeps state while it evaluates,
+// so it is locked as rules are matched concurrently.
+type pathMatcher struct {
+	path    string
+	mu      *sync.Mutex
+	parser  *jsonpath.JSONPath
+	pattern *regexp.Regexp
+}
+
+// compiledRule holds the matchers for the fields a rule sets
+type compiledRule struct {
+	fields []fieldMatcher
+	maps   []mapMatcher
+	paths  []pathMatcher
+	expr   cel.Program
+}
+
+func nodeOf(ev *kube.EnhancedEvent) kube.NodeInfo {
+	if ev.Node == nil {
+		return kube.NodeInfo{}
+	}
+	return *ev.Node
+}
+
+func (m fieldMatcher) matches(ev *kube.EnhancedEvent) bool {
+	return m.matcher.matchesField(m.field.value(ev))
+}
+
+func (m mapMatcher) matches(ev *kube.EnhancedEvent) bool {
+	return m.matcher.matchesKey(m.field.values(ev), m.key)
+}
+
+func newPathMatcher(path, pattern string) (pathMatcher, error) {
+	parser := jsonpath.New(path).AllowMissingKeys(true)
+	// Paths may be given without the braces, like in the custom columns of kubectl
+	template := path
+	if !strings.HasPrefix(template, "{") {
+		template = "{" + template + "}"
+	}
+	if err := parser.Parse(template); err != nil {
+		return pathMatcher{}, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return pathMatcher{}, err
+	}
+	return pathMatcher{path: path, mu: &sync.Mutex{}, parser: parser, pattern: re}, nil
+}
+
+// matches returns true if any of the values the path finds matches, a path that finds nothing does not match
+func (m pathMatcher) matches(obj interface{}) bool {
+	m.mu.Lock()
+	results, err := m.parser.FindResults(obj)
+	m.mu.Unlock()
+	if err != nil {
+		return false
+	}
+
+	for _, values := range results {
+		for _, v := range values {
+			if m.pattern.MatchString(pathValueString(v.Interface())) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathValueString formats a value like kubectl prints JSONPath results, strings as they are and anything else as JSON
+func pathValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// eventObject returns the event the way it is serialized, so that paths match the JSON the receivers get
+func eventObject(ev *kube.EnhancedEvent) (interface{}, error) {
+	var obj interface{}
+	if err := json.Unmarshal(ev.ToJSON(), &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+var ruleFields = []ruleField{
+	{"message", func(r *Rule) string { return r.Message }, func(ev *kube.EnhancedEvent) string { return ev.Message }},
+	{"apiVersion", func(r *Rule) string { return r.APIVersion }, func(ev *kube.EnhancedEvent) string { return ev.InvolvedObject.APIVersion }},
+	{"kind", func(r *Rule) string { return r.Kind }, func(ev *kube.EnhancedEvent) string { return ev.InvolvedObject.Kind }},
+	{"namespace", func(r *Rule) string { return r.Namespace }, func(ev *kube.EnhancedEvent) string { return ev.Namespace }},
+	{"reason", func(r *Rule) string { return r.Reason }, func(ev *kube.EnhancedEvent) string { return ev.Reason }},
+	{"type", func(r *Rule) string { return r.Type }, func(ev *kube.EnhancedEvent) string { return ev.Type }},
+	{"component", func(r *Rule) string { return r.Component }, func(ev *kube.EnhancedEvent) string { return ev.Source.Component }},
+	{"host", func(r *Rule) string { return r.Host }, func(ev *kube.EnhancedEvent) string { return ev.Source.Host }},
+	{"occurrence", func(r *Rule) string { return r.Occurrence }, func(ev *kube.EnhancedEvent) string { return ev.Occurrence }},
+	{"reportingController", func(r *Rule) string { return r.ReportingController }, func(ev *kube.EnhancedEvent) string { return ev.ReportingController }},
+	{"reportingInstance", func(r *Rule) string { return r.ReportingInstance }, func(ev *kube.EnhancedEvent) string { return ev.ReportingInstance }},
+	{"action", func(r *Rule) string { return r.Action }, func(ev *kube.EnhancedEvent) string { return ev.Action }},
+	{"cluster", func(r *Rule) string { return r.Cluster }, func(ev *kube.EnhancedEvent) string { return ev.ClusterName }},
+	{"ownerKind", func(r *Rule) string { return r.OwnerKind }, func(ev *kube.EnhancedEvent) string { return ev.InvolvedObject.TopLevelOwner().Kind }},
+	{"ownerName", func(r *Rule) string { return r.OwnerName }, func(ev *kube.EnhancedEvent) string { return ev.InvolvedObject.TopLevelOwner().Name }},
+	{"node", func(r *Rule) string { return r.Node }, func(ev *kube.EnhancedEvent) string { return nodeOf(ev).Name }},
+	{"zone", func(r *Rule) string { return r.Zone }, func(ev *kube.EnhancedEvent) string { return nodeOf(ev).Zone }},
+	{"region", func(r *Rule) string { return r.Region }, func(ev *kube.EnhancedEvent) string { return nodeOf(ev).Region }},
+	{"instanceType", func(r *Rule) string { return r.InstanceType }, func(ev *kube.EnhancedEvent) string { return nodeOf(ev).InstanceType }},
+}
+
+var ruleMapFields = []ruleMapField{
+	{"labels", func(r *Rule) map[string]string { return r.Labels }, func(ev *kube.EnhancedEvent) map[string]string { return ev.InvolvedObject.Labels }},
+	{"annotations", func(r *Rule) map[string]string { return r.Annotations }, func(ev *kube.EnhancedEvent) map[string]string { return ev.InvolvedObject.Annotations }},
+	{"ownerLabels", func(r *Rule) map[string]string { return r.OwnerLabels }, func(ev *kube.EnhancedEvent) map[string]string { return ev.InvolvedObject.TopLevelOwner().Labels }},
+	{"namespaceLabels", func(r *Rule) map[string]string { return r.NamespaceLabels }, func(ev *kube.EnhancedEvent) map[string]string { return ev.NamespaceLabels }},
+	{"namespaceAnnotations", func(r *Rule) map[string]string { return r.NamespaceAnnotations }, func(ev *kube.EnhancedEvent) map[string]string { return ev.NamespaceAnnotations }},
+}
@@ -1,9 +1,13 @@
 package exporter
 
 import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestEmptyRule(t *testing.T) {
@@ -355,3 +359,264 @@ func TestCount(t *testing.T) {
 
 	assert.False(t, r.MatchesEvent(ev))
 }
+
+func TestOccurrenceRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Occurrence = kube.OccurrenceRepeat
+
+	r := Rule{
+		Occurrence: kube.OccurrenceNew,
+	}
+	assert.False(t, r.MatchesEvent(ev))
+
+	r.Occurrence = kube.OccurrenceRepeat
+	assert.True(t, r.MatchesEvent(ev))
+}
+
+func TestReportingControllerRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.ReportingController = "kubelet"
+	ev.ReportingInstance = "kubelet-node1"
+
+	r := Rule{
+		ReportingController: "kubelet",
+		ReportingInstance:   "node2",
+	}
+	assert.False(t, r.MatchesEvent(ev))
+
+	r.ReportingInstance = "node1"
+	assert.True(t, r.MatchesEvent(ev))
+}
+
+func TestClusterRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.ClusterName = "prod-eu"
+
+	r := Rule{
+		Cluster: "prod-.*",
+	}
+	assert.True(t, r.MatchesEvent(ev))
+
+	r.Cluster = "staging-.*"
+	assert.False(t, r.MatchesEvent(ev))
+}
+
+func TestOwnerRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.InvolvedObject.OwnerChain = []kube.OwnerInfo{
+		{Kind: "ReplicaSet", Name: "web-123"},
+		{Kind: "Deployment", Name: "web", Labels: map[string]string{"team": "payments"}},
+	}
+
+	r := Rule{
+		OwnerKind:   "Deployment",
+		OwnerName:   "web",
+		OwnerLabels: map[string]string{"team": "pay.*"},
+	}
+	assert.True(t, r.MatchesEvent(ev))
+
+	r.OwnerKind = "ReplicaSet"
+	assert.False(t, r.MatchesEvent(ev))
+
+	r = Rule{OwnerLabels: map[string]string{"env": "prod"}}
+	assert.False(t, r.MatchesEvent(ev))
+
+	// Without an owner chain, owner rules never match
+	assert.False(t, r.MatchesEvent(&kube.EnhancedEvent{}))
+}
+
+func TestTopologyRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{
+		NamespaceLabels: map[string]string{"team": "payments"},
+		Node:            &kube.NodeInfo{Name: "node-1", Zone: "eu-west-1a", Region: "eu-west-1", InstanceType: "m5.large"},
+	}
+
+	r := Rule{
+		NamespaceLabels: map[string]string{"team": "payments"},
+		Zone:            "eu-west-1.*",
+		InstanceType:    "m5\\..*",
+	}
+	assert.True(t, r.MatchesEvent(ev))
+
+	r.Region = "us-east-1"
+	assert.False(t, r.MatchesEvent(ev))
+
+	r = Rule{NamespaceAnnotations: map[string]string{"cost-center": ".*"}}
+	assert.False(t, r.MatchesEvent(ev))
+
+	// Events without a node never match node rules
+	r = Rule{Node: "node-1"}
+	assert.True(t, r.MatchesEvent(ev))
+	assert.False(t, r.MatchesEvent(&kube.EnhancedEvent{}))
+}
+
+func TestMatcherRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "payments"
+	ev.Reason = "BackOff"
+	ev.InvolvedObject.Labels = map[string]string{"app": "web", "team": "payments"}
+
+	web := "web"
+	yes, no := true, false
+
+	r := Rule{Matchers: map[string]Matcher{
+		"namespace":   {NotIn: []string{"kube-system", "kube-public"}},
+		"reason":      {NotMatch: "^Success"},
+		"labels.app":  {Equals: &web},
+		"labels.team": {Exists: &yes},
+		"labels.tier": {Exists: &no},
+	}}
+	assert.True(t, r.MatchesEvent(ev))
+
+	ev.Namespace = "kube-system"
+	assert.False(t, r.MatchesEvent(ev))
+	ev.Namespace = "payments"
+
+	ev.InvolvedObject.Labels["tier"] = "frontend"
+	assert.False(t, r.MatchesEvent(ev))
+	delete(ev.InvolvedObject.Labels, "tier")
+
+	// Negations hold for missing labels, other conditions do not
+	r = Rule{Matchers: map[string]Matcher{"labels.env": {NotEquals: &web, NotIn: []string{"prod"}}}}
+	assert.True(t, r.MatchesEvent(ev))
+	r = Rule{Matchers: map[string]Matcher{"labels.env": {In: []string{"prod", "staging"}}}}
+	assert.False(t, r.MatchesEvent(ev))
+
+	// Empty fields do not exist
+	r = Rule{Matchers: map[string]Matcher{"component": {Exists: &no}}}
+	assert.True(t, r.MatchesEvent(ev))
+	ev.Source.Component = "kubelet"
+	assert.False(t, r.MatchesEvent(ev))
+
+	// Matchers are combined with the regular expression of the same field
+	r = Rule{Namespace: "pay.*", Matchers: map[string]Matcher{"namespace": {NotEquals: &web}}}
+	assert.True(t, r.MatchesEvent(ev))
+	r.Matchers["namespace"] = Matcher{NotMatch: "^pay"}
+	r.compiled = nil
+	assert.False(t, r.MatchesEvent(ev))
+}
+
+func TestMatcherRuleCompile(t *testing.T) {
+	r := Rule{Matchers: map[string]Matcher{"namespace": {NotMatch: "kube-("}}}
+	assert.EqualError(t, r.Compile(), "namespace: notMatch: error parsing regexp: missing closing ): `kube-(`")
+
+	r = Rule{Matchers: map[string]Matcher{"labels.app": {}}}
+	assert.EqualError(t, r.Compile(), "labels.app: matcher has no condition")
+
+	r = Rule{Matchers: map[string]Matcher{"severity": {In: []string{"high"}}}}
+	assert.EqualError(t, r.Compile(), "severity: unknown field")
+}
+
+func TestMatcherRuleYAML(t *testing.T) {
+	const yml = `
+namespace:
+  notIn: [kube-system, kube-public]
+reason: BackOff
+labels:
+  app: web
+  team:
+    exists: true
+  env:
+    notEquals: prod
+receiver: stdout
+`
+	var r Rule
+	require.NoError(t, yaml.Unmarshal([]byte(yml), &r))
+
+	prod, yes := "prod", true
+	assert.Equal(t, "BackOff", r.Reason)
+	assert.Equal(t, "stdout", r.Receiver)
+	assert.Empty(t, r.Namespace)
+	assert.Equal(t, map[string]string{"app": "web"}, r.Labels)
+	assert.Equal(t, map[string]Matcher{
+		"namespace":   {NotIn: []string{"kube-system", "kube-public"}},
+		"labels.team": {Exists: &yes},
+		"labels.env":  {NotEquals: &prod},
+	}, r.Matchers)
+
+	err := yaml.Unmarshal([]byte("namespace:\n  notMatches: kube-.*\n"), &r)
+	assert.ErrorContains(t, err, "namespace: ")
+}
+
+func TestExprRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Type = "Warning"
+	ev.Count = 5
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Name = "db-0"
+	ev.InvolvedObject.OwnerChain = []kube.OwnerInfo{{Kind: "StatefulSet", Name: "db"}}
+
+	r := Rule{Expr: `event.type == "Warning" && event.kind == "Pod" && event.ownerKind == "StatefulSet" && event.count > 3 &&
+		!("muted" in event.namespaceAnnotations && event.namespaceAnnotations["muted"] == "true")`}
+	require.NoError(t, r.Compile())
+	assert.True(t, r.MatchesEvent(ev))
+
+	ev.NamespaceAnnotations = map[string]string{"muted": "true"}
+	assert.False(t, r.MatchesEvent(ev))
+
+	// Expressions are combined with the other fields
+	r = Rule{Kind: "Deployment", Expr: `event.name.startsWith("db-")`}
+	assert.False(t, r.MatchesEvent(ev))
+	r.Kind = "Pod"
+	r.compiled = nil
+	assert.True(t, r.MatchesEvent(ev))
+
+	// A missing key fails the evaluation, so the rule does not match
+	r = Rule{Expr: `event.labels["app"] == "db"`}
+	assert.False(t, r.MatchesEvent(ev))
+	r = Rule{Expr: `!("app" in event.labels)`}
+	assert.True(t, r.MatchesEvent(ev))
+}
+
+func TestExprRuleCompile(t *testing.T) {
+	r := Rule{Expr: `event.count > "3"`}
+	assert.ErrorContains(t, r.Compile(), "expr: ERROR: <input>:1:13: found no matching overload for '_>_' applied to '(int, string)'")
+
+	r = Rule{Expr: `event.severity == "high"`}
+	assert.ErrorContains(t, r.Compile(), "undefined field 'severity'")
+
+	r = Rule{Expr: `event.count`}
+	assert.EqualError(t, r.Compile(), "expr: must evaluate to a bool, not int")
+
+	r = Rule{Expr: `event.reason ==`}
+	assert.ErrorContains(t, r.Compile(), "expr: ERROR: <input>:1:16: Syntax error")
+}
+
+func TestFieldsRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.ClusterName = "eu"
+	ev.InvolvedObject.Name = "web-7d9f"
+	ev.InvolvedObject.FieldPath = "spec.containers{sidecar}"
+	ev.InvolvedObject.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web"}}
+	ev.Count = 12
+
+	r := Rule{Fields: map[string]string{
+		".involvedObject.name":        "^web-",
+		"{.involvedObject.fieldPath}": "\\{sidecar\\}",
+		".clusterName":                "eu",
+	}}
+	require.NoError(t, r.Compile())
+	assert.True(t, r.MatchesEvent(ev))
+
+	// Any of the values found matches
+	r = Rule{Fields: map[string]string{".involvedObject.ownerReferences[*].kind": "ReplicaSet"}}
+	assert.True(t, r.MatchesEvent(ev))
+
+	// Values that are not strings are matched as JSON
+	r = Rule{Fields: map[string]string{".count": "^1[0-9]$"}}
+	assert.True(t, r.MatchesEvent(ev))
+
+	// A path that finds nothing does not match
+	r = Rule{Fields: map[string]string{".involvedObject.uid": ".*"}}
+	assert.False(t, r.MatchesEvent(ev))
+	r = Rule{Fields: map[string]string{".involvedObject.name": "^db-"}}
+	assert.False(t, r.MatchesEvent(ev))
+}
+
+func TestFieldsRuleCompile(t *testing.T) {
+	r := Rule{Fields: map[string]string{".involvedObject.name": "web-("}}
+	assert.EqualError(t, r.Compile(), "fields[.involvedObject.name]: error parsing regexp: missing closing ): `web-(`")
+
+	r = Rule{Fields: map[string]string{".involvedObject[": ".*"}}
+	assert.ErrorContains(t, r.Compile(), "fields[.involvedObject[]: ")
+}
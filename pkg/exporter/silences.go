@@ -0,0 +1,447 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// SilencesPath is where the silences API is served on the metrics server
+	SilencesPath = "/api/v1/silences"
+
+	SilenceStatePending = "pending"
+	SilenceStateActive  = "active"
+	SilenceStateExpired = "expired"
+
+	defaultSilencesName    = "kubernetes-event-exporter-silences"
+	defaultSilencesRefresh = 30 * time.Second
+	silencesKey            = "silences.json"
+	// silenceRetention is how long expired silences are still listed before they are removed from the ConfigMap
+	silenceRetention = 24 * time.Hour
+	maxSilenceBody   = 1 << 20
+)
+
+var (
+	errInvalidSilence  = errors.New("invalid silence")
+	errSilenceNotFound = errors.New("silence not found")
+)
+
+// SilencesConfig enables muting events through the silences API of the metrics server. The silences are kept in a
+// ConfigMap, so that they survive restarts and are shared by all replicas.
+type SilencesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Namespace and Name of the ConfigMap that holds the silences. Namespace defaults to the namespace the exporter
+	// runs in.
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// RefreshSeconds is how often the ConfigMap is read again to pick up the silences created on other replicas
+	RefreshSeconds int64 `yaml:"refreshSeconds"`
+}
+
+func (c SilencesConfig) GetRefresh() time.Duration {
+	if c.RefreshSeconds <= 0 {
+		return defaultSilencesRefresh
+	}
+	return time.Duration(c.RefreshSeconds) * time.Second
+}
+
+// Silence drops the events that match it between StartsAt and EndsAt before they reach any receiver
+type Silence struct {
+	ID string `json:"id"`
+	// Match has the same fields as a rule of the route, e.g. {"namespace": "shop", "reason": "BackOff"}
+	Match     map[string]interface{} `json:"match"`
+	StartsAt  time.Time              `json:"startsAt"`
+	EndsAt    time.Time              `json:"endsAt"`
+	CreatedBy string                 `json:"createdBy"`
+	Comment   string                 `json:"comment"`
+}
+
+func (s *Silence) state(now time.Time) string {
+	switch {
+	case now.Before(s.StartsAt):
+		return SilenceStatePending
+	case now.Before(s.EndsAt):
+		return SilenceStateActive
+	default:
+		return SilenceStateExpired
+	}
+}
+
+// rule compiles the matchers of the silence into a rule
+func (s *Silence) rule() (*Rule, error) {
+	if len(s.Match) == 0 {
+		return nil, errors.New("match is required")
+	}
+	if _, ok := s.Match["receiver"]; ok {
+		return nil, errors.New("match.receiver: silences drop events, they have no receiver")
+	}
+	// Decoding a copy keeps the match intact, unknown fields are rejected as a misspelled field would widen the silence
+	b, err := yaml.Marshal(s.Match)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("match: %w", err)
+	}
+	var rule Rule
+	if err := rule.decode(raw, yaml.DisallowUnknownField()); err != nil {
+		return nil, fmt.Errorf("match: %w", err)
+	}
+	if err := rule.Compile(); err != nil {
+		return nil, fmt.Errorf("match.%w", err)
+	}
+	// Empty maps match nothing, a silence without any matcher would mute every event
+	if c := rule.compiled; len(c.fields) == 0 && len(c.maps) == 0 && len(c.paths) == 0 && c.expr == nil && rule.MinCount == 0 {
+		return nil, errors.New("match has no matcher")
+	}
+	return &rule, nil
+}
+
+// SilenceStatus is a silence as listed by the API
+type SilenceStatus struct {
+	Silence
+	State string `json:"state"`
+	// Silenced is the number of events this replica dropped because of the silence since it started
+	Silenced int64 `json:"silenced"`
+}
+
+type compiledSilence struct {
+	Silence
+	rule *Rule
+}
+
+// Silences holds the silences of the ConfigMap and serves the silences API. It is safe for concurrent use.
+type Silences struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	refresh   time.Duration
+	// metricsStore counts the silenced events per silence, it is optional
+	metricsStore *metrics.Store
+
+	mu       sync.RWMutex
+	silences []compiledSilence
+	// counts outlive reloads of the silences, they are only kept in memory
+	counts map[string]*atomic.Int64
+	now    func() time.Time
+}
+
+func NewSilences(cfg SilencesConfig, clientset kubernetes.Interface, metricsStore *metrics.Store) *Silences {
+	name := cfg.Name
+	if name == "" {
+		name = defaultSilencesName
+	}
+	return &Silences{
+		clientset:    clientset,
+		namespace:    kube.NamespaceOrDefault(cfg.Namespace),
+		name:         name,
+		refresh:      cfg.GetRefresh(),
+		metricsStore: metricsStore,
+		counts:       make(map[string]*atomic.Int64),
+		now:          time.Now,
+	}
+}
+
+// Load reads the silences from the ConfigMap. There are no silences if the ConfigMap does not exist yet.
+func (s *Silences) Load(ctx context.Context) error {
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		s.set(nil)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	silences, err := decodeSilences(cm)
+	if err != nil {
+		return err
+	}
+	s.set(silences)
+	return nil
+}
+
+// Run reloads the silences until the context is done
+func (s *Silences) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.Error().Err(err).Str("configmap", s.namespace+"/"+s.name).Msg("Cannot load silences")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Silences) set(silences []Silence) {
+	compiled := make([]compiledSilence, 0, len(silences))
+	for _, silence := range silences {
+		rule, err := silence.rule()
+		if err != nil {
+			// Silences are validated when they are created, someone must have edited the ConfigMap by hand
+			log.Error().Err(err).Str("id", silence.ID).Msg("Ignoring invalid silence")
+			continue
+		}
+		compiled = append(compiled, compiledSilence{Silence: silence, rule: rule})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silences = compiled
+	for _, silence := range compiled {
+		if s.counts[silence.ID] == nil {
+			s.counts[silence.ID] = new(atomic.Int64)
+		}
+	}
+	for id := range s.counts {
+		if !hasSilence(compiled, id) {
+			delete(s.counts, id)
+			if s.metricsStore != nil {
+				s.metricsStore.SilenceEvents.DeleteLabelValues(id)
+			}
+		}
+	}
+}
+
+func hasSilence(silences []compiledSilence, id string) bool {
+	for _, silence := range silences {
+		if silence.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Silenced returns true if an active silence matches the event. The event is counted for the first silence that
+// matches it.
+func (s *Silences) Silenced(ev *kube.EnhancedEvent) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	for _, silence := range s.silences {
+		if silence.state(now) == SilenceStateActive && silence.rule.MatchesEvent(ev) {
+			s.counts[silence.ID].Add(1)
+			if s.metricsStore != nil {
+				s.metricsStore.SilenceEvents.WithLabelValues(silence.ID).Inc()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the silences that are pending, active or expired recently, in the order they were created
+func (s *Silences) List() []SilenceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	statuses := make([]SilenceStatus, 0, len(s.silences))
+	for _, silence := range s.silences {
+		statuses = append(statuses, SilenceStatus{
+			Silence:  silence.Silence,
+			State:    silence.state(now),
+			Silenced: s.counts[silence.ID].Load(),
+		})
+	}
+	return statuses
+}
+
+// Create validates and stores a new silence. It starts right away if StartsAt is not given.
+func (s *Silences) Create(ctx context.Context, silence Silence) (Silence, error) {
+	now := s.now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return Silence{}, fmt.Errorf("%w: endsAt must be after startsAt", errInvalidSilence)
+	}
+	if !silence.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("%w: endsAt must be in the future", errInvalidSilence)
+	}
+	if _, err := silence.rule(); err != nil {
+		return Silence{}, fmt.Errorf("%w: %s", errInvalidSilence, err)
+	}
+	silence.ID = string(uuid.NewUUID())
+
+	err := s.update(ctx, func(silences []Silence) ([]Silence, error) {
+		return append(silences, silence), nil
+	})
+	if err != nil {
+		return Silence{}, err
+	}
+	return silence, nil
+}
+
+// Expire ends the silence now, it is still listed as expired for a while
+func (s *Silences) Expire(ctx context.Context, id string) error {
+	return s.update(ctx, func(silences []Silence) ([]Silence, error) {
+		now := s.now()
+		for i := range silences {
+			if silences[i].ID != id {
+				continue
+			}
+			if silences[i].state(now) == SilenceStateExpired {
+				return silences, nil
+			}
+			if silences[i].StartsAt.After(now) {
+				silences[i].StartsAt = now
+			}
+			silences[i].EndsAt = now
+			return silences, nil
+		}
+		return nil, errSilenceNotFound
+	})
+}
+
+// update changes the silences of the ConfigMap and removes the silences that expired more than silenceRetention ago
+func (s *Silences) update(ctx context.Context, change func([]Silence) ([]Silence, error)) error {
+	configMaps := s.clientset.CoreV1().ConfigMaps(s.namespace)
+	var updated []Silence
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		found := err == nil
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+		} else if err != nil {
+			return err
+		}
+
+		silences, err := decodeSilences(cm)
+		if err != nil {
+			return err
+		}
+		if silences, err = change(silences); err != nil {
+			return err
+		}
+
+		cutoff := s.now().Add(-silenceRetention)
+		updated = silences[:0]
+		for _, silence := range silences {
+			if silence.EndsAt.After(cutoff) {
+				updated = append(updated, silence)
+			}
+		}
+
+		b, err := json.MarshalIndent(updated, "", "  ")
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[silencesKey] = string(b)
+
+		if found {
+			_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		} else {
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.set(updated)
+	return nil
+}
+
+func decodeSilences(cm *corev1.ConfigMap) ([]Silence, error) {
+	val, ok := cm.Data[silencesKey]
+	if !ok || val == "" {
+		return nil, nil
+	}
+	var silences []Silence
+	if err := json.Unmarshal([]byte(val), &silences); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", silencesKey, err)
+	}
+	return silences, nil
+}
+
+// ServeHTTP lists the silences on GET and creates one on POST to SilencesPath, a DELETE of SilencesPath/<id> expires
+// the silence
+func (s *Silences) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, SilencesPath), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		writeSilencesJSON(w, http.StatusOK, s.List())
+	case id == "" && r.Method == http.MethodPost:
+		s.create(w, r)
+	case id == "":
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodDelete:
+		err := s.Expire(r.Context(), id)
+		if errors.Is(err, errSilenceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Error().Err(err).Str("id", id).Msg("Cannot expire silence")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Silences) create(w http.ResponseWriter, r *http.Request) {
+	var silence Silence
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSilenceBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&silence); err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", errInvalidSilence, err), http.StatusBadRequest)
+		return
+	}
+
+	silence, err := s.Create(r.Context(), silence)
+	if errors.Is(err, errInvalidSilence) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("Cannot create silence")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().
+		Str("id", silence.ID).
+		Str("createdBy", silence.CreatedBy).
+		Time("endsAt", silence.EndsAt).
+		Msg("Created silence")
+	writeSilencesJSON(w, http.StatusCreated, SilenceStatus{Silence: silence, State: silence.state(s.now())})
+}
+
+func writeSilencesJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Cannot write silences response")
+	}
+}
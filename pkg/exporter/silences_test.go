@@ -0,0 +1,209 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/kube"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestSilences(clientset *fake.Clientset, now *time.Time, metricsStore *metrics.Store) *Silences {
+	s := NewSilences(SilencesConfig{Namespace: "monitoring"}, clientset, metricsStore)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func silenceEvent(namespace, reason string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = namespace
+	ev.Reason = reason
+	return ev
+}
+
+func TestSilences(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestSilences(clientset, &now, metricsStore)
+
+	require.NoError(t, s.Load(ctx))
+	require.Empty(t, s.List())
+
+	silence, err := s.Create(ctx, Silence{
+		Match:     map[string]interface{}{"namespace": "shop", "reason": "BackOff"},
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "jane",
+		Comment:   "shop maintenance",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, silence.ID)
+	require.Equal(t, now, silence.StartsAt)
+
+	assert.True(t, s.Silenced(silenceEvent("shop", "BackOff")))
+	assert.True(t, s.Silenced(silenceEvent("shop", "BackOff")))
+	assert.False(t, s.Silenced(silenceEvent("shop", "Pulled")))
+	assert.False(t, s.Silenced(silenceEvent("orders", "BackOff")))
+
+	list := s.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, SilenceStateActive, list[0].State)
+	assert.Equal(t, int64(2), list[0].Silenced)
+	assert.Equal(t, "jane", list[0].CreatedBy)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricsStore.SilenceEvents.WithLabelValues(silence.ID)))
+
+	// The silences are persisted, another replica picks them up
+	cm, err := clientset.CoreV1().ConfigMaps("monitoring").Get(ctx, defaultSilencesName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Contains(t, cm.Data[silencesKey], silence.ID)
+
+	other := newTestSilences(clientset, &now, metricsStore)
+	require.NoError(t, other.Load(ctx))
+	assert.True(t, other.Silenced(silenceEvent("shop", "BackOff")))
+
+	// Reloading keeps the counts
+	require.NoError(t, s.Load(ctx))
+	assert.Equal(t, int64(2), s.List()[0].Silenced)
+
+	require.NoError(t, s.Expire(ctx, silence.ID))
+	assert.False(t, s.Silenced(silenceEvent("shop", "BackOff")))
+	assert.Equal(t, SilenceStateExpired, s.List()[0].State)
+	require.ErrorIs(t, s.Expire(ctx, "unknown"), errSilenceNotFound)
+
+	// Silences that start later are pending until then
+	_, err = s.Create(ctx, Silence{
+		Match:    map[string]interface{}{"namespace": "orders"},
+		StartsAt: now.Add(time.Hour),
+		EndsAt:   now.Add(2 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SilenceStatePending, s.List()[1].State)
+	assert.False(t, s.Silenced(silenceEvent("orders", "BackOff")))
+
+	now = now.Add(90 * time.Minute)
+	assert.True(t, s.Silenced(silenceEvent("orders", "BackOff")))
+
+	// Expired silences are removed from the ConfigMap after a day
+	now = now.Add(25 * time.Hour)
+	_, err = s.Create(ctx, Silence{Match: map[string]interface{}{"kind": "Pod"}, EndsAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	list = s.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "Pod", list[0].Match["kind"])
+	// Removed silences drop out of the metric
+	require.NoError(t, other.Load(ctx))
+	assert.Equal(t, 0, testutil.CollectAndCount(metricsStore.SilenceEvents))
+}
+
+func TestSilenceValidation(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestSilences(fake.NewSimpleClientset(), &now, nil)
+
+	tests := []struct {
+		name    string
+		silence Silence
+		err     string
+	}{
+		{"no match", Silence{EndsAt: now.Add(time.Hour)}, "match is required"},
+		{"unknown fields", Silence{Match: map[string]interface{}{"namespce": "shop"}, EndsAt: now.Add(time.Hour)}, "namespce"},
+		{"misspelled field", Silence{Match: map[string]interface{}{"namspace": "shop", "reason": "BackOff"}, EndsAt: now.Add(time.Hour)}, "namspace"},
+		{"misspelled matcher", Silence{Match: map[string]interface{}{"namspace": map[string]interface{}{"in": []interface{}{"shop"}}, "reason": "BackOff"}, EndsAt: now.Add(time.Hour)}, "namspace"},
+		{"empty labels", Silence{Match: map[string]interface{}{"labels": map[string]interface{}{}}, EndsAt: now.Add(time.Hour)}, "match has no matcher"},
+		{"receiver", Silence{Match: map[string]interface{}{"receiver": "x", "reason": "BackOff"}, EndsAt: now.Add(time.Hour)}, "match.receiver"},
+		{"invalid pattern", Silence{Match: map[string]interface{}{"reason": "BackOff["}, EndsAt: now.Add(time.Hour)}, "match.reason"},
+		{"ends before start", Silence{Match: map[string]interface{}{"reason": "BackOff"}, StartsAt: now.Add(time.Hour), EndsAt: now}, "endsAt must be after startsAt"},
+		{"ended", Silence{Match: map[string]interface{}{"reason": "BackOff"}, StartsAt: now.Add(-time.Hour), EndsAt: now}, "endsAt must be in the future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Create(context.Background(), tt.silence)
+			require.ErrorIs(t, err, errInvalidSilence)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	// Matchers, maps and numbers have the same shape as in the rules of the route
+	silence, err := s.Create(context.Background(), Silence{
+		Match: map[string]interface{}{
+			"namespace": map[string]interface{}{"in": []interface{}{"shop", "orders"}},
+			"labels":    map[string]interface{}{"app": "web"},
+			"minCount":  float64(3),
+		},
+		EndsAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	ev := silenceEvent("orders", "BackOff")
+	ev.InvolvedObject.Labels = map[string]string{"app": "web"}
+	assert.False(t, s.Silenced(ev))
+	ev.Count = 3
+	assert.True(t, s.Silenced(ev))
+	assert.Equal(t, int64(1), s.List()[0].Silenced)
+	assert.Equal(t, silence.ID, s.List()[0].ID)
+}
+
+func TestSilencesAPI(t *testing.T) {
+	now := time.Now()
+	s := newTestSilences(fake.NewSimpleClientset(), &now, nil)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, SilencesPath, `{
+		"match": {"namespace": "shop"},
+		"endsAt": "`+now.Add(time.Hour).Format(time.RFC3339)+`",
+		"createdBy": "jane",
+		"comment": "maintenance"
+	}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created SilenceStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, SilenceStateActive, created.State)
+
+	rec = serve(http.MethodPost, SilencesPath, `{"match": {"namespace": "shop"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(http.MethodPost, SilencesPath, `{"matchers": {"namespace": "shop"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// A misspelled field would silence every BackOff event
+	rec = serve(http.MethodPost, SilencesPath, `{
+		"match": {"namspace": "shop", "reason": "BackOff"},
+		"endsAt": "`+now.Add(time.Hour).Format(time.RFC3339)+`"
+	}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "namspace")
+
+	require.True(t, s.Silenced(silenceEvent("shop", "BackOff")))
+	rec = serve(http.MethodGet, SilencesPath, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []SilenceStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Equal(t, int64(1), list[0].Silenced)
+
+	rec = serve(http.MethodDelete, SilencesPath+"/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.False(t, s.Silenced(silenceEvent("shop", "BackOff")))
+
+	rec = serve(http.MethodDelete, SilencesPath+"/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(http.MethodPut, SilencesPath, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
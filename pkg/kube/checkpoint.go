@@ -0,0 +1,486 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	CheckpointStorageConfigMap = "configmap"
+	CheckpointStorageFile      = "file"
+
+	checkpointAnnotation         = "kubernetes-event-exporter/checkpoint"
+	defaultCheckpointName        = "kubernetes-event-exporter-checkpoint"
+	defaultCheckpointInterval    = 10 * time.Second
+	defaultCheckpointMaxExported = 2000
+	checkpointSaveTimeout        = 10 * time.Second
+)
+
+// CheckpointConfig enables persisting what has been exported so that a restarted exporter or a new leader can
+// resume where the previous one stopped
+type CheckpointConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Storage is either "configmap" (default) or "file"
+	Storage string `yaml:"storage"`
+	// Namespace and Name of the ConfigMap whose annotation holds the checkpoint. Namespace defaults to the
+	// namespace the exporter runs in.
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// Path of the checkpoint file when using the file storage
+	Path string `yaml:"path"`
+	// IntervalSeconds is how often the checkpoint is persisted, it is always persisted on shutdown
+	IntervalSeconds int64 `yaml:"intervalSeconds"`
+	// MaxExported is the number of recently exported event UIDs kept in the checkpoint
+	MaxExported int `yaml:"maxExported"`
+}
+
+// Checkpoint is the persisted state of the exporter
+type Checkpoint struct {
+	// ResourceVersion is the highest resource version of the exported events
+	ResourceVersion string `json:"resourceVersion"`
+	// Timestamp is the latest timestamp of the exported events
+	Timestamp time.Time `json:"timestamp"`
+	// Exported contains the recently exported events from the oldest to the newest
+	Exported []ExportedEvent `json:"exported"`
+}
+
+type ExportedEvent struct {
+	UID   types.UID `json:"uid"`
+	Count int32     `json:"count"`
+}
+
+// CheckpointStore loads and saves the checkpoint. Load returns nil without an error if there is no checkpoint yet.
+type CheckpointStore interface {
+	Load(ctx context.Context) (*Checkpoint, error)
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+}
+
+func NewCheckpointStore(cfg CheckpointConfig, clientset kubernetes.Interface) (CheckpointStore, error) {
+	switch cfg.Storage {
+	case CheckpointStorageFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("checkpoint path is required for the file storage")
+		}
+		return &fileCheckpointStore{path: cfg.Path}, nil
+	case CheckpointStorageConfigMap, "":
+		namespace := NamespaceOrDefault(cfg.Namespace)
+		name := cfg.Name
+		if name == "" {
+			name = defaultCheckpointName
+		}
+		return &configMapCheckpointStore{clientset: clientset, namespace: namespace, name: name}, nil
+	default:
+		return nil, fmt.Errorf("unknown checkpoint storage: %s", cfg.Storage)
+	}
+}
+
+type fileCheckpointStore struct {
+	path string
+}
+
+func (f *fileCheckpointStore) Load(_ context.Context) (*Checkpoint, error) {
+	b, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (f *fileCheckpointStore) Save(_ context.Context, checkpoint *Checkpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash never leaves a truncated checkpoint behind
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+type configMapCheckpointStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (c *configMapCheckpointStore) Load(ctx context.Context) (*Checkpoint, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	val, ok := cm.Annotations[checkpointAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal([]byte(val), &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (c *configMapCheckpointStore) Save(ctx context.Context, checkpoint *Checkpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	configMaps := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, c.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        c.name,
+					Namespace:   c.namespace,
+					Annotations: map[string]string{checkpointAnnotation: string(b)},
+				},
+			}, metav1.CreateOptions{})
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[checkpointAnnotation] = string(b)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+type resumeState int
+
+const (
+	// resumeNone means the checkpoint knows nothing about the event, it is processed as usual
+	resumeNone resumeState = iota
+	// resumeExported means the event has already been exported with the same count
+	resumeExported
+	// resumeUpdated means the event has been exported before, but its count increased while nobody was exporting
+	resumeUpdated
+	// resumeMissed means the event occurred while nobody was exporting
+	resumeMissed
+	// resumeCovered means the event is at or below the high-water mark of the checkpoint but has fallen out of its
+	// exported events. It has been exported, or discarded because of its age, before the checkpoint was taken.
+	resumeCovered
+)
+
+// checkpointTracker keeps the checkpoint up to date while events are exported and decides which of the events
+// delivered by the initial list of the informer have been missed.
+type checkpointTracker struct {
+	mu              sync.Mutex
+	store           CheckpointStore
+	interval        time.Duration
+	exported        *lru.Cache
+	resourceVersion string
+	timestamp       time.Time
+	dirty           bool
+	// inFlight are the events handed to the enrichment workers that are not exported yet. The workers export events
+	// out of order, the persisted resource version and timestamp stay below the in-flight events so that a restart
+	// does not skip them.
+	inFlight map[uint64]*corev1.Event
+	nextID   uint64
+	// resumeFrom is the loaded checkpoint, events that happened between it and startedAt have been missed
+	resumeFrom *Checkpoint
+	startedAt  time.Time
+}
+
+func newCheckpointTracker(cfg CheckpointConfig, store CheckpointStore) *checkpointTracker {
+	size := cfg.MaxExported
+	if size <= 0 {
+		size = defaultCheckpointMaxExported
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		panic("cannot init cache: " + err.Error())
+	}
+
+	interval := time.Second * time.Duration(cfg.IntervalSeconds)
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	return &checkpointTracker{
+		store:    store,
+		interval: interval,
+		exported: cache,
+		inFlight: make(map[uint64]*corev1.Event),
+	}
+}
+
+// load reads the persisted checkpoint and arms the resume logic
+func (c *checkpointTracker) load(ctx context.Context) error {
+	checkpoint, err := c.reload(ctx)
+	if err != nil {
+		return err
+	}
+
+	if checkpoint == nil {
+		log.Info().Msg("No checkpoint found, starting from scratch")
+		return nil
+	}
+
+	log.Info().
+		Str("resourceVersion", checkpoint.ResourceVersion).
+		Time("timestamp", checkpoint.Timestamp).
+		Int("exported", len(checkpoint.Exported)).
+		Msg("Resuming from checkpoint")
+	return nil
+}
+
+// reload is load without logging, standby replicas reload the checkpoint of the leader periodically
+func (c *checkpointTracker) reload(ctx context.Context) (*Checkpoint, error) {
+	checkpoint, err := c.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.startedAt = time.Now()
+	if checkpoint == nil {
+		return nil, nil
+	}
+
+	for _, v := range checkpoint.Exported {
+		c.exported.Add(v.UID, v.Count)
+	}
+	c.resourceVersion = checkpoint.ResourceVersion
+	c.timestamp = checkpoint.Timestamp
+	c.resumeFrom = checkpoint
+	return checkpoint, nil
+}
+
+// state returns how the event relates to the checkpoint. For resumeUpdated, the previously exported count is
+// returned as well.
+func (c *checkpointTracker) state(event *corev1.Event) (resumeState, int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if val, ok := c.exported.Peek(event.UID); ok {
+		count := val.(int32)
+		if event.Count <= count {
+			return resumeExported, count
+		}
+		if c.isMissed(event) {
+			return resumeUpdated, count
+		}
+		return resumeNone, count
+	}
+
+	if c.isMissed(event) {
+		return resumeMissed, 0
+	}
+	if c.isCovered(event) {
+		return resumeCovered, 0
+	}
+	return resumeNone, 0
+}
+
+// isMissed returns true for events that happened after the checkpoint was taken but before this exporter started.
+// Events that happen later are live events and do not need any special handling.
+func (c *checkpointTracker) isMissed(event *corev1.Event) bool {
+	if c.resumeFrom == nil || !eventTimestamp(event).Before(c.startedAt) {
+		return false
+	}
+	return isNewerThanCheckpoint(event, c.resumeFrom)
+}
+
+// isCovered returns true for events that happened before this exporter started and are not newer than the checkpoint
+func (c *checkpointTracker) isCovered(event *corev1.Event) bool {
+	if c.resumeFrom == nil || !eventTimestamp(event).Before(c.startedAt) {
+		return false
+	}
+	return !isNewerThanCheckpoint(event, c.resumeFrom)
+}
+
+// begin marks the event as in flight until it is recorded or abandoned with the returned id
+func (c *checkpointTracker) begin(event *corev1.Event) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	c.inFlight[c.nextID] = event
+	return c.nextID
+}
+
+// abandon forgets an in-flight event that is not exported
+func (c *checkpointTracker) abandon(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inFlight, id)
+}
+
+// record marks the event as exported, id is the in-flight id of the event or 0
+func (c *checkpointTracker) record(id uint64, event *corev1.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.inFlight, id)
+
+	c.exported.Add(event.UID, event.Count)
+	// The first numeric resource version sets the high-water mark, later ones only move it forward
+	if c.resourceVersion == "" && isNumericResourceVersion(event.ResourceVersion) ||
+		compareResourceVersions(event.ResourceVersion, c.resourceVersion) > 0 {
+		c.resourceVersion = event.ResourceVersion
+	}
+	if timestamp := eventTimestamp(event); timestamp.After(c.timestamp) {
+		c.timestamp = timestamp
+	}
+	c.dirty = true
+}
+
+func (c *checkpointTracker) snapshot() *Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checkpoint := &Checkpoint{
+		ResourceVersion: c.resourceVersion,
+		Timestamp:       c.timestamp,
+		Exported:        make([]ExportedEvent, 0, c.exported.Len()),
+	}
+	// The high-water mark never passes an event that is still in flight
+	for _, event := range c.inFlight {
+		if checkpoint.ResourceVersion != "" && compareResourceVersions(event.ResourceVersion, checkpoint.ResourceVersion) <= 0 {
+			checkpoint.ResourceVersion = previousResourceVersion(event.ResourceVersion, checkpoint.ResourceVersion)
+		}
+		if timestamp := eventTimestamp(event); !timestamp.After(checkpoint.Timestamp) {
+			checkpoint.Timestamp = timestamp.Add(-time.Nanosecond)
+		}
+	}
+	// Keys are ordered from the oldest to the newest
+	for _, key := range c.exported.Keys() {
+		if val, ok := c.exported.Peek(key); ok {
+			checkpoint.Exported = append(checkpoint.Exported, ExportedEvent{UID: key.(types.UID), Count: val.(int32)})
+		}
+	}
+	c.dirty = false
+	return checkpoint
+}
+
+func (c *checkpointTracker) isDirty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dirty
+}
+
+// save persists the checkpoint if anything has been exported since the last save
+func (c *checkpointTracker) save() error {
+	if !c.isDirty() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointSaveTimeout)
+	defer cancel()
+	return c.store.Save(ctx, c.snapshot())
+}
+
+// run persists the checkpoint periodically until the stop channel is closed
+func (c *checkpointTracker) run(stopCh <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				onError(err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func isNewerThanCheckpoint(event *corev1.Event, checkpoint *Checkpoint) bool {
+	if cmp := compareResourceVersions(event.ResourceVersion, checkpoint.ResourceVersion); cmp != 0 {
+		return cmp > 0
+	}
+	return eventTimestamp(event).After(checkpoint.Timestamp)
+}
+
+// compareResourceVersions compares two resource versions if both are numeric, which is the case for etcd backed
+// clusters. Otherwise 0 is returned and the caller should fall back to timestamps, this includes an empty version.
+func compareResourceVersions(a, b string) int {
+	x, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return 0
+	}
+	y, err := strconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	switch {
+	case x > y:
+		return 1
+	case x < y:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func isNumericResourceVersion(resourceVersion string) bool {
+	_, err := strconv.ParseUint(resourceVersion, 10, 64)
+	return err == nil
+}
+
+// previousResourceVersion returns the numeric resource version right before the given one, or fallback if it is not
+// numeric
+func previousResourceVersion(resourceVersion, fallback string) string {
+	x, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if err != nil || x == 0 {
+		return fallback
+	}
+	return strconv.FormatUint(x-1, 10)
+}
+
+func eventTimestamp(event *corev1.Event) time.Time {
+	timestamp := event.LastTimestamp.Time
+	if timestamp.IsZero() {
+		timestamp = event.EventTime.Time
+	}
+	return timestamp
+}
@@ -0,0 +1,170 @@
+package kube
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	store := &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")}
+
+	checkpoint, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	expected := &Checkpoint{
+		ResourceVersion: "42",
+		Timestamp:       time.Now().UTC().Truncate(time.Second),
+		Exported:        []ExportedEvent{{UID: "a", Count: 1}, {UID: "b", Count: 3}},
+	}
+	require.NoError(t, store.Save(context.Background(), expected))
+
+	checkpoint, err = store.Load(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, checkpoint)
+}
+
+func TestConfigMapCheckpointStore(t *testing.T) {
+	store := &configMapCheckpointStore{clientset: fake.NewSimpleClientset(), namespace: "monitoring", name: "checkpoint"}
+
+	checkpoint, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	// The first save creates the ConfigMap, the second one updates it
+	require.NoError(t, store.Save(context.Background(), &Checkpoint{ResourceVersion: "1"}))
+	require.NoError(t, store.Save(context.Background(), &Checkpoint{ResourceVersion: "2"}))
+
+	checkpoint, err = store.Load(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "2", checkpoint.ResourceVersion)
+}
+
+func TestCheckpointTracker_InFlight(t *testing.T) {
+	tracker := newCheckpointTracker(CheckpointConfig{}, &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")})
+	now := time.Now().Truncate(time.Second)
+	event := func(uid, resourceVersion string, at time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:    metav1.ObjectMeta{UID: types.UID(uid), ResourceVersion: resourceVersion},
+			LastTimestamp: metav1.Time{Time: at},
+			Count:         1,
+		}
+	}
+
+	first := event("a", "5", now)
+	second := event("b", "6", now.Add(time.Second))
+	third := event("c", "7", now.Add(2*time.Second))
+	firstID := tracker.begin(first)
+	secondID := tracker.begin(second)
+	thirdID := tracker.begin(third)
+
+	// A worker exports the second event before the first one, which is still being looked up
+	tracker.record(secondID, second)
+	checkpoint := tracker.snapshot()
+	require.Equal(t, "4", checkpoint.ResourceVersion)
+	require.True(t, checkpoint.Timestamp.Before(now))
+	require.Len(t, checkpoint.Exported, 1)
+
+	tracker.record(firstID, first)
+	checkpoint = tracker.snapshot()
+	require.Equal(t, "6", checkpoint.ResourceVersion)
+	require.Equal(t, now.Add(time.Second), checkpoint.Timestamp)
+
+	// Dropped events do not hold the checkpoint back
+	tracker.abandon(thirdID)
+	require.Equal(t, "6", tracker.snapshot().ResourceVersion)
+}
+
+func TestCheckpointTracker_EmptyResourceVersion(t *testing.T) {
+	tracker := newCheckpointTracker(CheckpointConfig{}, &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")})
+	now := time.Now().Truncate(time.Second)
+
+	// An event in flight does not lower a high-water mark that is not set yet
+	event := &corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "a", ResourceVersion: "5"}, LastTimestamp: metav1.Time{Time: now}}
+	id := tracker.begin(event)
+	require.Empty(t, tracker.snapshot().ResourceVersion)
+
+	// The first numeric resource version sets it
+	tracker.record(id, event)
+	require.Equal(t, "5", tracker.snapshot().ResourceVersion)
+
+	// Without a resource version in the checkpoint the timestamps decide
+	checkpoint := &Checkpoint{Timestamp: now}
+	require.False(t, isNewerThanCheckpoint(event, checkpoint))
+	event.LastTimestamp = metav1.Time{Time: now.Add(time.Second)}
+	require.True(t, isNewerThanCheckpoint(event, checkpoint))
+}
+
+func TestCompareResourceVersions(t *testing.T) {
+	require.Equal(t, 1, compareResourceVersions("10", "9"))
+	require.Equal(t, -1, compareResourceVersions("9", "10"))
+	require.Equal(t, 0, compareResourceVersions("10", "10"))
+	require.Equal(t, 0, compareResourceVersions("10", ""))
+	require.Equal(t, 0, compareResourceVersions("abc", "10"))
+}
+
+func TestOnEvent_ResumesFromCheckpoint(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(5, metricsStore)
+
+	now := time.Now()
+	store := &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	require.NoError(t, store.Save(context.Background(), &Checkpoint{
+		ResourceVersion: "100",
+		Timestamp:       now.Add(-10 * time.Minute),
+		Exported:        []ExportedEvent{{UID: "exported", Count: 1}},
+	}))
+	ew.checkpoint = newCheckpointTracker(CheckpointConfig{Enabled: true}, store)
+	require.NoError(t, ew.checkpoint.load(context.Background()))
+
+	exported := make([]types.UID, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		exported = append(exported, e.UID)
+	}
+
+	// Exported before the checkpoint was taken
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "exported", ResourceVersion: "90"},
+		LastTimestamp: metav1.Time{Time: now.Add(-11 * time.Minute)},
+		Count:         1,
+	})
+	// Happened while nobody was exporting, it is older than maxEventAgeSeconds but must not be lost
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "missed", ResourceVersion: "110"},
+		LastTimestamp: metav1.Time{Time: now.Add(-5 * time.Minute)},
+		Count:         1,
+	})
+	// Happened before the checkpoint and was discarded back then
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "old", ResourceVersion: "80"},
+		LastTimestamp: metav1.Time{Time: now.Add(-20 * time.Minute)},
+		Count:         1,
+	})
+	// Relisted after being exported during resume
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "missed", ResourceVersion: "110"},
+		LastTimestamp: metav1.Time{Time: now.Add(-5 * time.Minute)},
+		Count:         1,
+	})
+
+	require.Equal(t, []types.UID{"missed"}, exported)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.CheckpointEventsResumed))
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.CheckpointDuplicatesSkipped))
+
+	require.NoError(t, ew.checkpoint.save())
+	checkpoint, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "110", checkpoint.ResourceVersion)
+	require.Equal(t, []ExportedEvent{{UID: "exported", Count: 1}, {UID: "missed", Count: 1}}, checkpoint.Exported)
+}
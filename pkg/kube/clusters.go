@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const defaultKubeconfigSecretKey = "kubeconfig"
+
+// ClusterConfig is one of the clusters watched in multi-cluster mode
+type ClusterConfig struct {
+	// Name is stamped as clusterName onto the events of the cluster
+	Name string `yaml:"name"`
+	// Kubeconfig is the path of the kubeconfig file, the default loading rules are used if empty
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the kubeconfig context to use, the current context is used if empty
+	Context string `yaml:"context"`
+	// Secret refers to a secret holding the kubeconfig, in the cluster the exporter runs in
+	Secret    *KubeconfigSecretRef `yaml:"secret"`
+	KubeQPS   float32              `yaml:"kubeQPS,omitempty"`
+	KubeBurst int                  `yaml:"kubeBurst,omitempty"`
+	CacheSize int                  `yaml:"cacheSize,omitempty"`
+}
+
+type KubeconfigSecretRef struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// Key in the secret data, defaults to "kubeconfig"
+	Key string `yaml:"key"`
+}
+
+// GetClusterConfig builds the rest config of the cluster. The local config is used to read kubeconfig secrets.
+func GetClusterConfig(cluster ClusterConfig, local *rest.Config) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+
+	if cluster.Secret != nil {
+		config, err = getKubeconfigFromSecret(cluster.Secret, cluster.Context, local)
+	} else {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = cluster.Kubeconfig
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			loadingRules,
+			&clientcmd.ConfigOverrides{CurrentContext: cluster.Context},
+		).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", cluster.Name, err)
+	}
+
+	config.QPS = cluster.KubeQPS
+	config.Burst = cluster.KubeBurst
+	return config, nil
+}
+
+func getKubeconfigFromSecret(ref *KubeconfigSecretRef, kubeContext string, local *rest.Config) (*rest.Config, error) {
+	clientset, err := kubernetes.NewForConfig(local)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(ref.Namespace).Get(context.Background(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultKubeconfigSecretKey
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", ref.Namespace, ref.Name, key)
+	}
+
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.NewNonInteractiveClientConfig(*kubeconfig, kubeContext, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+}
@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: eu
+clusters:
+  - name: eu
+    cluster:
+      server: https://eu.example.com
+  - name: us
+    cluster:
+      server: https://us.example.com
+contexts:
+  - name: eu
+    context:
+      cluster: eu
+      user: admin
+  - name: us
+    context:
+      cluster: us
+      user: admin
+users:
+  - name: admin
+    user:
+      token: secret
+`
+
+func TestGetClusterConfig_Context(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+	config, err := GetClusterConfig(ClusterConfig{Name: "eu", Kubeconfig: path, KubeQPS: 10, KubeBurst: 20}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://eu.example.com", config.Host)
+	require.Equal(t, float32(10), config.QPS)
+	require.Equal(t, 20, config.Burst)
+
+	config, err = GetClusterConfig(ClusterConfig{Name: "us", Kubeconfig: path, Context: "us"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://us.example.com", config.Host)
+
+	_, err = GetClusterConfig(ClusterConfig{Name: "asia", Kubeconfig: path, Context: "asia"}, nil)
+	require.ErrorContains(t, err, "cluster asia")
+}
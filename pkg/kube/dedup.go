@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultDedupTTL       = time.Hour
+	defaultDedupCacheSize = 10000
+)
+
+// DedupConfig controls the suppression of events that are received again after the informer relisted, e.g. once a
+// watch failed. Deduplication is enabled by default.
+type DedupConfig struct {
+	Disabled bool `yaml:"disabled"`
+	// TTLSeconds is how long an exported event is remembered, defaults to 3600 which is the default event TTL of the
+	// API server
+	TTLSeconds int64 `yaml:"ttlSeconds"`
+	// CacheSize is the number of exported events that are remembered, defaults to 10000
+	CacheSize int `yaml:"cacheSize"`
+}
+
+type seenEvent struct {
+	resourceVersion string
+	count           int32
+	at              time.Time
+}
+
+// seenEvents remembers the resource version and count of the exported events by UID. An event whose count has not
+// increased since it was exported is a replay of the same occurrence.
+type seenEvents struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func newSeenEvents(cfg DedupConfig) *seenEvents {
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = defaultDedupCacheSize
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		panic("cannot init cache: " + err.Error())
+	}
+
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+
+	return &seenEvents{cache: cache, ttl: ttl, now: time.Now}
+}
+
+// record remembers an exported event
+func (s *seenEvents) record(event *corev1.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache.Add(event.UID, seenEvent{resourceVersion: event.ResourceVersion, count: event.Count, at: s.now()})
+}
+
+// seen returns true if the same or a later occurrence of the event has been exported within the TTL
+func (s *seenEvents) seen(event *corev1.Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	val, ok := s.cache.Get(event.UID)
+	if !ok {
+		return false
+	}
+	last := val.(seenEvent)
+	if s.now().Sub(last.at) > s.ttl {
+		s.cache.Remove(event.UID)
+		return false
+	}
+	return last.resourceVersion == event.ResourceVersion || event.Count <= last.count
+}
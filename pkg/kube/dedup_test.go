@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOnEvent_SuppressesReplayedEvents(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.seen = newSeenEvents(DedupConfig{TTLSeconds: 60})
+	now := time.Now()
+	ew.seen.now = func() time.Time { return now }
+
+	exported := make([]int32, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		exported = append(exported, e.Count)
+	}
+
+	event := &corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "event", ResourceVersion: "1"},
+		LastTimestamp: metav1.Time{Time: now},
+		Count:         1,
+	}
+	ew.onEvent(event)
+	// Relisted after a failed watch
+	ew.onEvent(event.DeepCopy())
+	require.Equal(t, []int32{1}, exported)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.DuplicatesSuppressed))
+
+	// The event occurred again while the watch was down
+	repeated := event.DeepCopy()
+	repeated.ResourceVersion = "2"
+	repeated.Count = 2
+	ew.onEvent(repeated)
+	ew.onEvent(repeated.DeepCopy())
+	require.Equal(t, []int32{1, 2}, exported)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.DuplicatesSuppressed))
+
+	// Forgotten after the TTL
+	now = now.Add(2 * time.Minute)
+	repeated.LastTimestamp = metav1.Time{Time: now}
+	ew.onEvent(repeated)
+	require.Equal(t, []int32{1, 2, 2}, exported)
+}
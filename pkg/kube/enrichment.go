@@ -0,0 +1,200 @@
+package kube
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	defaultEnrichmentWorkers       = 8
+	defaultEnrichmentQueueSize     = 1000
+	defaultEnrichmentTimeout       = 10 * time.Second
+	defaultNotFoundCacheTTLSeconds = 60
+)
+
+// EnrichmentConfig controls the lookups of the involved objects. They run on a pool of workers so that a slow API
+// server does not hold up the informers.
+type EnrichmentConfig struct {
+	// Workers is the number of concurrent lookups, defaults to 8
+	Workers int `yaml:"workers"`
+	// QueueSize is the number of events waiting for a worker, defaults to 1000. Events that do not fit are exported
+	// without metadata.
+	QueueSize int `yaml:"queueSize"`
+	// TimeoutSeconds bounds the lookups of a single event, including its owner chain, defaults to 10
+	TimeoutSeconds int64 `yaml:"timeoutSeconds"`
+	// DropOnTimeout drops events whose lookup timed out, they are exported without metadata otherwise
+	DropOnTimeout bool `yaml:"dropOnTimeout"`
+	// NotFoundCacheSeconds is how long objects that do not exist are remembered, defaults to 60
+	NotFoundCacheSeconds int64 `yaml:"notFoundCacheSeconds"`
+	// Namespace adds the labels and annotations of the namespace of the event
+	Namespace bool `yaml:"namespace"`
+	// Node adds the name, zone, region and instance type of the node to Pod and Node events
+	Node bool `yaml:"node"`
+	// Logs attaches container logs to failure events of pods
+	Logs LogTailConfig `yaml:"logs"`
+}
+
+func (c EnrichmentConfig) notFoundTTL() time.Duration {
+	if c.NotFoundCacheSeconds == 0 {
+		return defaultNotFoundCacheTTLSeconds * time.Second
+	}
+	return time.Duration(c.NotFoundCacheSeconds) * time.Second
+}
+
+// enrichmentJob is an event waiting for the metadata of its involved object
+type enrichmentJob struct {
+	ev       *EnhancedEvent
+	event    *corev1.Event
+	decorate func(ev *EnhancedEvent)
+	// checkpointID is the in-flight id of the event in the checkpoint, if any
+	checkpointID uint64
+	// warm jobs only fill the metadata cache of standby replicas
+	warm bool
+}
+
+type enrichmentPool struct {
+	jobs          chan enrichmentJob
+	wg            sync.WaitGroup
+	workers       int
+	timeout       time.Duration
+	dropOnTimeout bool
+	// lastDequeue is the time in unix nanoseconds a worker last picked up a job
+	lastDequeue atomic.Int64
+}
+
+func newEnrichmentPool(cfg EnrichmentConfig) *enrichmentPool {
+	p := &enrichmentPool{
+		workers:       cfg.Workers,
+		timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		dropOnTimeout: cfg.DropOnTimeout,
+	}
+	if p.workers <= 0 {
+		p.workers = defaultEnrichmentWorkers
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultEnrichmentTimeout
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultEnrichmentQueueSize
+	}
+	p.jobs = make(chan enrichmentJob, queueSize)
+	return p
+}
+
+// enqueue hands the event to the workers. If the queue is full the event is exported right away without metadata,
+// as blocking would hold up the informer and dropping would lose the event.
+func (e *EventWatcher) enqueue(job enrichmentJob) {
+	select {
+	case e.enrichment.jobs <- job:
+		e.metricsStore.EnrichmentQueueDepth.Inc()
+	default:
+		log.Warn().
+			Str("namespace", job.event.Namespace).
+			Str("name", job.event.Name).
+			Msg("Enrichment queue is full, exporting event without metadata")
+		e.metricsStore.EnrichmentSkipped.Inc()
+		job.ev.InvolvedObject.ObjectReference = *job.event.InvolvedObject.DeepCopy()
+		e.deliver(job)
+	}
+}
+
+func (e *EventWatcher) startEnrichment() {
+	e.enrichment.lastDequeue.Store(time.Now().UnixNano())
+	for i := 0; i < e.enrichment.workers; i++ {
+		e.enrichment.wg.Add(1)
+		go func() {
+			defer e.enrichment.wg.Done()
+			for job := range e.enrichment.jobs {
+				e.enrichment.lastDequeue.Store(time.Now().UnixNano())
+				e.metricsStore.EnrichmentQueueDepth.Dec()
+				e.process(job)
+			}
+		}()
+	}
+}
+
+// stopEnrichment waits for the queued events to be exported. No event may be enqueued afterwards.
+func (e *EventWatcher) stopEnrichment() {
+	close(e.enrichment.jobs)
+	e.enrichment.wg.Wait()
+}
+
+func (e *EventWatcher) process(job enrichmentJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.enrichment.timeout)
+	defer cancel()
+
+	if job.warm {
+		e.warmMetadata(ctx, job.event)
+		return
+	}
+
+	start := time.Now()
+	e.enrich(ctx, job.ev, job.event)
+	e.metricsStore.EnrichmentLatency.Observe(time.Since(start).Seconds())
+
+	if ctx.Err() != nil {
+		e.metricsStore.EnrichmentTimeouts.Inc()
+		msg := "Looking up the involved object timed out, exporting event with the metadata found so far"
+		if e.enrichment.dropOnTimeout {
+			msg = "Looking up the involved object timed out, dropping event"
+		}
+		log.Warn().
+			Str("namespace", job.event.Namespace).
+			Str("name", job.event.Name).
+			Str("involvedObject", job.event.InvolvedObject.Name).
+			Msg(msg)
+		if e.enrichment.dropOnTimeout {
+			if e.checkpoint != nil {
+				e.checkpoint.abandon(job.checkpointID)
+			}
+			return
+		}
+	}
+
+	e.tailLogs(job.ev)
+	e.deliver(job)
+}
+
+// enrich adds the metadata of the involved object to the event. The event is left without metadata if the lookup
+// fails.
+func (e *EventWatcher) enrich(ctx context.Context, ev *EnhancedEvent, event *corev1.Event) {
+	ev.InvolvedObject.ObjectReference = *event.InvolvedObject.DeepCopy()
+	if e.topology != nil {
+		e.topology.enrich(ctx, ev, e.metricsStore)
+	}
+
+	objectMetadata, err := e.objectMetadataCache.GetObjectMetadata(ctx, &event.InvolvedObject, e.dynamicClient, e.metricsStore)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			ev.InvolvedObject.Deleted = true
+			log.Error().Err(err).Msg("Object not found, likely deleted")
+		} else {
+			log.Error().Err(err).Msg("Failed to get object metadata")
+		}
+		return
+	}
+
+	ev.InvolvedObject.Labels = objectMetadata.Labels
+	ev.InvolvedObject.Annotations = objectMetadata.Annotations
+	ev.InvolvedObject.OwnerReferences = objectMetadata.OwnerReferences
+	ev.InvolvedObject.Deleted = objectMetadata.Deleted
+	if e.ownerChain.Enabled {
+		ev.InvolvedObject.OwnerChain = e.resolveOwnerChain(ctx, event.InvolvedObject.Namespace, objectMetadata.OwnerReferences)
+	}
+}
+
+// tailLogs attaches the container logs once the involved object is looked up. They have a deadline of their own, as
+// the logs are only a decoration and must not use up the time of the lookup.
+func (e *EventWatcher) tailLogs(ev *EnhancedEvent) {
+	if e.logTailer != nil {
+		e.logTailer.tail(context.Background(), ev, e.metricsStore)
+	}
+}
@@ -0,0 +1,206 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// blockingObjectMetadataProvider never answers before the deadline
+type blockingObjectMetadataProvider struct{}
+
+func (blockingObjectMetadataProvider) GetObjectMetadata(ctx context.Context, _ *corev1.ObjectReference, _ dynamic.Interface, _ *metrics.Store) (ObjectMetadata, error) {
+	<-ctx.Done()
+	return ObjectMetadata{}, ctx.Err()
+}
+
+type podRESTMapper struct{}
+
+func (podRESTMapper) RESTMapping(gk schema.GroupKind, _ ...string) (*meta.RESTMapping, error) {
+	return &meta.RESTMapping{Resource: schema.GroupVersionResource{Version: "v1", Resource: "pods"}}, nil
+}
+
+func newEnrichmentTestEvent() *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "web-1.123", UID: "event"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1", UID: "pod"},
+		Count:          1,
+	}
+}
+
+func TestEnrichment_Timeout(t *testing.T) {
+	for _, dropOnTimeout := range []bool{false, true} {
+		metricsStore := metrics.NewMetricsStore("test_")
+		ew := newMockEventWatcher(300, metricsStore)
+		ew.objectMetadataCache = blockingObjectMetadataProvider{}
+		ew.enrichment = newEnrichmentPool(EnrichmentConfig{Workers: 1, DropOnTimeout: dropOnTimeout})
+		ew.enrichment.timeout = 10 * time.Millisecond
+		ew.seen = newSeenEvents(DedupConfig{})
+
+		exported := make([]*EnhancedEvent, 0)
+		ew.fn = func(ev *EnhancedEvent) {
+			exported = append(exported, ev)
+		}
+
+		event := newEnrichmentTestEvent()
+		ew.startEnrichment()
+		ew.export(event, func(ev *EnhancedEvent) {})
+		ew.stopEnrichment()
+
+		// Dropped events are not seen, so that a relist exports them
+		require.Equal(t, !dropOnTimeout, ew.seen.seen(event))
+
+		require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.EnrichmentTimeouts))
+		require.Equal(t, float64(0), testutil.ToFloat64(metricsStore.EnrichmentQueueDepth))
+		if dropOnTimeout {
+			require.Empty(t, exported)
+		} else {
+			require.Len(t, exported, 1)
+			require.Equal(t, "web-1", exported[0].InvolvedObject.Name)
+			require.Nil(t, exported[0].InvolvedObject.Labels)
+		}
+		metrics.DestroyMetricsStore(metricsStore)
+	}
+}
+
+func TestEnrichment_SlowLogs(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	// The logs take longer than the lookup may
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "log" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return false, nil, nil
+	})
+
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.logTailer = newLogTailer(LogTailConfig{Enabled: true}, clientset)
+	ew.enrichment = newEnrichmentPool(EnrichmentConfig{Workers: 1, DropOnTimeout: true})
+	ew.enrichment.timeout = 20 * time.Millisecond
+
+	exported := make([]*EnhancedEvent, 0)
+	ew.fn = func(ev *EnhancedEvent) {
+		exported = append(exported, ev)
+	}
+
+	event := newEnrichmentTestEvent()
+	event.Reason = "BackOff"
+	ew.startEnrichment()
+	ew.export(event, func(ev *EnhancedEvent) {})
+	ew.stopEnrichment()
+
+	require.Len(t, exported, 1)
+	require.Equal(t, map[string]string{"test": "test"}, exported[0].InvolvedObject.Labels)
+	require.Equal(t, "fake logs", exported[0].Logs.Tail)
+	require.Equal(t, float64(0), testutil.ToFloat64(metricsStore.EnrichmentTimeouts))
+}
+
+func TestEnrichment_QueueFull(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.enrichment = newEnrichmentPool(EnrichmentConfig{QueueSize: 1})
+
+	exported := make([]*EnhancedEvent, 0)
+	ew.fn = func(ev *EnhancedEvent) {
+		exported = append(exported, ev)
+	}
+
+	// Without workers the first event stays queued and the second one is exported right away
+	ew.export(newEnrichmentTestEvent(), func(ev *EnhancedEvent) {})
+	ew.export(newEnrichmentTestEvent(), func(ev *EnhancedEvent) {})
+	require.Len(t, exported, 1)
+	require.Nil(t, exported[0].InvolvedObject.Labels)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.EnrichmentSkipped))
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.EnrichmentQueueDepth))
+
+	ew.startEnrichment()
+	ew.stopEnrichment()
+	require.Len(t, exported, 2)
+	require.Equal(t, map[string]string{"test": "test"}, exported[1].InvolvedObject.Labels)
+}
+
+func TestObjectMetadataCache_NotFound(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	provider := NewObjectMetadataProvider(16, podRESTMapper{}, time.Minute).(*ObjectMetadataCache)
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	reference := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web-1", UID: "pod", ResourceVersion: "1"}
+	for i := 0; i < 3; i++ {
+		_, err := provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+		require.True(t, errors.IsNotFound(err))
+	}
+	require.Len(t, client.Actions(), 1)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.KubeApiReadCacheHits))
+
+	now = now.Add(time.Minute)
+	_, err := provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.True(t, errors.IsNotFound(err))
+	require.Len(t, client.Actions(), 2)
+}
+
+func TestObjectMetadataCache_UnversionedTTL(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("web-1")
+	pod.SetLabels(map[string]string{"team": "payments"})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+	provider := NewObjectMetadataProvider(16, podRESTMapper{}, time.Minute).(*ObjectMetadataCache)
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	// Owner references have no resource version, the metadata is cached by UID for a while
+	reference := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web-1", UID: "pod"}
+	metadata, err := provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, "payments", metadata.Labels["team"])
+
+	pod.SetLabels(map[string]string{"team": "orders"})
+	_, err = client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "pods"}).Namespace("default").Update(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	metadata, err = provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, "payments", metadata.Labels["team"])
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.KubeApiReadRequests))
+
+	now = now.Add(unversionedMetadataTTL)
+	metadata, err = provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, "orders", metadata.Labels["team"])
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.KubeApiReadRequests))
+
+	// Versioned lookups change their cache key on updates and never expire
+	reference.ResourceVersion = "1"
+	_, err = provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	_, err = provider.GetObjectMetadata(context.Background(), reference, client, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, float64(3), testutil.ToFloat64(metricsStore.KubeApiReadRequests))
+}
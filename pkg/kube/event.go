@@ -13,6 +13,31 @@ type EnhancedEvent struct {
 	corev1.Event   `json:",inline"`
 	ClusterName    string                  `json:"clusterName"`
 	InvolvedObject EnhancedObjectReference `json:"involvedObject"`
+	// Occurrence is "new" for the first export of an event and "repeat" for exported count updates
+	Occurrence string `json:"occurrence,omitempty"`
+	// PreviousCount is the count of the event when it was exported the last time, only set for repeats
+	PreviousCount int32 `json:"previousCount,omitempty"`
+	// CountDelta is the number of occurrences since the last export, only set for repeats
+	CountDelta int32 `json:"countDelta,omitempty"`
+	// RateLimited is the number of events like this one that were not exported because of a rate limit, it is only
+	// set for the summaries of rate limits with overflow: summarize
+	RateLimited int32 `json:"rateLimited,omitempty"`
+	// Group is only set for the digest a receiver with grouping sends instead of the events of a group, the digest
+	// is the first event of the group
+	Group *EventGroup `json:"group,omitempty"`
+	// Note and Regarding are only set when watching the events.k8s.io/v1 API. They hold the same values as
+	// Message and InvolvedObject which are kept for backwards compatibility.
+	Note      string                  `json:"note,omitempty"`
+	Regarding *corev1.ObjectReference `json:"regarding,omitempty"`
+	// NamespaceLabels and NamespaceAnnotations belong to the namespace of the event, they are only set if
+	// enrichment.namespace is enabled in the config
+	NamespaceLabels      map[string]string `json:"namespaceLabels,omitempty"`
+	NamespaceAnnotations map[string]string `json:"namespaceAnnotations,omitempty"`
+	// Node is the node of the involved Pod or Node, it is only set if enrichment.node is enabled in the config
+	Node *NodeInfo `json:"node,omitempty"`
+	// Logs is the tail of the container logs of failure events, it is only set if enrichment.logs is enabled in
+	// the config
+	Logs *ContainerLogs `json:"logs,omitempty"`
 }
 
 // DeDot replaces all dots in the labels and annotations with underscores. This is required for example in the
@@ -24,6 +49,15 @@ func (e EnhancedEvent) DeDot() EnhancedEvent {
 	c.Annotations = dedotMap(e.Annotations)
 	c.InvolvedObject.Labels = dedotMap(e.InvolvedObject.Labels)
 	c.InvolvedObject.Annotations = dedotMap(e.InvolvedObject.Annotations)
+	c.NamespaceLabels = dedotMap(e.NamespaceLabels)
+	c.NamespaceAnnotations = dedotMap(e.NamespaceAnnotations)
+	if len(e.InvolvedObject.OwnerChain) > 0 {
+		c.InvolvedObject.OwnerChain = make([]OwnerInfo, len(e.InvolvedObject.OwnerChain))
+		for i, owner := range e.InvolvedObject.OwnerChain {
+			owner.Labels = dedotMap(owner.Labels)
+			c.InvolvedObject.OwnerChain[i] = owner
+		}
+	}
 	return c
 }
 
@@ -39,12 +73,47 @@ func dedotMap(in map[string]string) map[string]string {
 	return ret
 }
 
+// EventGroup lists the distinct reasons and objects of the events of a group
+type EventGroup struct {
+	Key string `json:"key"`
+	// Count is the number of events in the group
+	Count   int           `json:"count"`
+	Reasons []GroupReason `json:"reasons"`
+	Objects []GroupObject `json:"objects"`
+}
+
+// GroupReason is a reason of the events of a group along with the number of events
+type GroupReason struct {
+	Reason string `json:"reason"`
+	Type   string `json:"type"`
+	Count  int    `json:"count"`
+}
+
+// GroupObject is an involved object of the events of a group along with the number of events
+type GroupObject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+}
+
 type EnhancedObjectReference struct {
 	corev1.ObjectReference `json:",inline"`
 	Labels                 map[string]string       `json:"labels,omitempty"`
 	Annotations            map[string]string       `json:"annotations,omitempty"`
 	OwnerReferences        []metav1.OwnerReference `json:"ownerReferences,omitempty"`
-	Deleted                bool                    `json:"deleted"`
+	// OwnerChain lists the controllers of the object from the direct owner up to the top level workload.
+	// It is only set if ownerChain is enabled in the config.
+	OwnerChain []OwnerInfo `json:"ownerChain,omitempty"`
+	Deleted    bool        `json:"deleted"`
+}
+
+// TopLevelOwner returns the last controller in the owner chain, or an empty OwnerInfo if there is none
+func (o EnhancedObjectReference) TopLevelOwner() OwnerInfo {
+	if len(o.OwnerChain) == 0 {
+		return OwnerInfo{}
+	}
+	return o.OwnerChain[len(o.OwnerChain)-1]
 }
 
 // ToJSON does not return an error because we are %99 confident it is JSON serializable.
@@ -0,0 +1,66 @@
+package kube
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+)
+
+const (
+	// EventsAPICoreV1 watches the events through the core/v1 API, this is the default
+	EventsAPICoreV1 = "v1"
+	// EventsAPIEventsV1 watches the events through the events.k8s.io/v1 API
+	EventsAPIEventsV1 = "events.k8s.io/v1"
+)
+
+// toCoreEvent returns the core/v1 representation of the objects delivered by both informers
+func toCoreEvent(obj interface{}) (*corev1.Event, bool) {
+	switch ev := obj.(type) {
+	case *corev1.Event:
+		return ev, true
+	case *eventsv1.Event:
+		return convertEventsV1(ev), true
+	default:
+		return nil, false
+	}
+}
+
+// convertEventsV1 normalizes an events.k8s.io/v1 event into the core/v1 shape that the rest of the exporter uses.
+// Regarding becomes InvolvedObject and Note becomes Message, the series is folded into Count and LastTimestamp
+// so that rules like minCount and the maxEventAgeSeconds check work the same for both APIs.
+func convertEventsV1(ev *eventsv1.Event) *corev1.Event {
+	event := &corev1.Event{
+		ObjectMeta:          ev.ObjectMeta,
+		InvolvedObject:      ev.Regarding,
+		Reason:              ev.Reason,
+		Message:             ev.Note,
+		Source:              ev.DeprecatedSource,
+		FirstTimestamp:      ev.DeprecatedFirstTimestamp,
+		LastTimestamp:       ev.DeprecatedLastTimestamp,
+		Count:               ev.DeprecatedCount,
+		Type:                ev.Type,
+		EventTime:           ev.EventTime,
+		Action:              ev.Action,
+		Related:             ev.Related,
+		ReportingController: ev.ReportingController,
+		ReportingInstance:   ev.ReportingInstance,
+	}
+
+	if event.Source.Component == "" {
+		event.Source.Component = ev.ReportingController
+	}
+
+	if ev.Series != nil {
+		event.Series = &corev1.EventSeries{
+			Count:            ev.Series.Count,
+			LastObservedTime: ev.Series.LastObservedTime,
+		}
+		event.Count = ev.Series.Count
+		event.LastTimestamp.Time = ev.Series.LastObservedTime.Time
+	}
+
+	if event.Count == 0 {
+		event.Count = 1
+	}
+
+	return event
+}
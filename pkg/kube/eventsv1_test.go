@@ -0,0 +1,75 @@
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertEventsV1(t *testing.T) {
+	now := time.Now()
+	ev := &eventsv1.Event{
+		ObjectMeta:          metav1.ObjectMeta{Name: "event1", Namespace: "default"},
+		EventTime:           metav1.MicroTime{Time: now.Add(-time.Minute)},
+		Series:              &eventsv1.EventSeries{Count: 4, LastObservedTime: metav1.MicroTime{Time: now}},
+		ReportingController: "kubelet",
+		ReportingInstance:   "kubelet-node1",
+		Action:              "Pulling",
+		Reason:              "BackOff",
+		Regarding:           corev1.ObjectReference{Kind: "Pod", Name: "pod1"},
+		Related:             &corev1.ObjectReference{Kind: "Node", Name: "node1"},
+		Note:                "Back-off restarting failed container",
+		Type:                "Warning",
+	}
+
+	event := convertEventsV1(ev)
+
+	require.Equal(t, "Back-off restarting failed container", event.Message)
+	require.Equal(t, "pod1", event.InvolvedObject.Name)
+	require.Equal(t, "node1", event.Related.Name)
+	require.Equal(t, "kubelet", event.Source.Component)
+	require.Equal(t, "kubelet-node1", event.ReportingInstance)
+	require.Equal(t, int32(4), event.Count)
+	require.Equal(t, int32(4), event.Series.Count)
+	require.True(t, event.LastTimestamp.Time.Equal(now))
+}
+
+func TestConvertEventsV1_WithoutSeries(t *testing.T) {
+	event := convertEventsV1(&eventsv1.Event{
+		DeprecatedSource:    corev1.EventSource{Component: "scheduler"},
+		ReportingController: "default-scheduler",
+	})
+
+	require.Equal(t, int32(1), event.Count)
+	require.Nil(t, event.Series)
+	require.Equal(t, "scheduler", event.Source.Component)
+}
+
+func TestOnAdd_EventsV1(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.eventsAPI = EventsAPIEventsV1
+
+	event := EnhancedEvent{}
+	ew.fn = func(e *EnhancedEvent) {
+		event = *e
+	}
+
+	ew.OnAdd(&eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "event1"},
+		EventTime:  metav1.MicroTime{Time: time.Now()},
+		Regarding:  corev1.ObjectReference{UID: "test", Name: "test-1"},
+		Note:       "hello",
+	})
+
+	require.Equal(t, "hello", event.Message)
+	require.Equal(t, "hello", event.Note)
+	require.Equal(t, "test-1", event.Regarding.Name)
+	require.Equal(t, map[string]string{"test": "test"}, event.InvolvedObject.Labels)
+}
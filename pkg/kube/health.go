@@ -0,0 +1,142 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+)
+
+// A watch error makes the watcher unready until the informer makes progress again. Errors older than this are
+// ignored, a failing watch reports a new error at least every 30 seconds while the reflector backs off.
+const watchErrorWindow = time.Minute
+
+type informerStatus struct {
+	Synced           bool       `json:"synced"`
+	ResourceVersion  string     `json:"resourceVersion,omitempty"`
+	LastWatchError   string     `json:"lastWatchError,omitempty"`
+	LastWatchErrorAt *time.Time `json:"lastWatchErrorAt,omitempty"`
+}
+
+type watcherStatus struct {
+	State           string                    `json:"state"`
+	Informers       map[string]informerStatus `json:"informers"`
+	EnrichmentQueue int                       `json:"enrichmentQueue"`
+}
+
+// recordWatchError remembers the last watch error along with the resource version the informer was at
+func (i *eventInformer) recordWatchError(err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.watchError = err
+	i.watchErrorAt = time.Now()
+	i.watchErrorVersion = i.informer.LastSyncResourceVersion()
+}
+
+func (i *eventInformer) check(now time.Time) error {
+	if !i.informer.HasSynced() {
+		return errors.New("not synced")
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.watchError != nil && now.Sub(i.watchErrorAt) < watchErrorWindow && i.informer.LastSyncResourceVersion() == i.watchErrorVersion {
+		return fmt.Errorf("watch failing: %w", i.watchError)
+	}
+	return nil
+}
+
+func (i *eventInformer) status() informerStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	status := informerStatus{
+		Synced:          i.informer.HasSynced(),
+		ResourceVersion: i.informer.LastSyncResourceVersion(),
+	}
+	if i.watchError != nil {
+		at := i.watchErrorAt
+		status.LastWatchError = i.watchError.Error()
+		status.LastWatchErrorAt = &at
+	}
+	return status
+}
+
+func (e *EventWatcher) healthName() string {
+	if e.clusterName == "" {
+		return "watcher"
+	}
+	return "watcher/" + e.clusterName
+}
+
+func (e *EventWatcher) registerHealth() {
+	name := e.healthName()
+	metrics.RegisterReadinessCheck(name, e.checkReady)
+	metrics.RegisterLivenessCheck(name, e.busySince)
+	metrics.RegisterStatus(name, e.status)
+}
+
+// checkReady fails until the informers have synced, while a watch is failing and once the watcher is stopped.
+// Standby watchers are ready once their informers have synced, so that a rollout waits for them to be warm.
+func (e *EventWatcher) checkReady() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopped {
+		return errors.New("stopped")
+	}
+	if e.namespaceInformer != nil && !e.namespaceInformer.HasSynced() {
+		return errors.New("namespaces not synced")
+	}
+	if e.topology != nil {
+		for _, informer := range e.topology.informers() {
+			if !informer.HasSynced() {
+				return errors.New("topology not synced")
+			}
+		}
+	}
+
+	now := time.Now()
+	for namespace, i := range e.informers {
+		if err := i.check(now); err != nil {
+			return fmt.Errorf("events in %s: %w", namespaceDisplayName(namespace), err)
+		}
+	}
+	return nil
+}
+
+// busySince reports since when queued events wait for an enrichment worker to pick them up
+func (e *EventWatcher) busySince() time.Time {
+	if e.enrichment == nil || len(e.enrichment.jobs) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, e.enrichment.lastDequeue.Load())
+}
+
+func (e *EventWatcher) status() interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := watcherStatus{State: "active", Informers: make(map[string]informerStatus, len(e.informers))}
+	switch {
+	case e.stopped:
+		status.State = "stopped"
+	case e.standby:
+		status.State = "standby"
+	}
+	for namespace, i := range e.informers {
+		status.Informers[namespaceDisplayName(namespace)] = i.status()
+	}
+	if e.enrichment != nil {
+		status.EnrichmentQueue = len(e.enrichment.jobs)
+	}
+	return status
+}
+
+func namespaceDisplayName(namespace string) string {
+	if namespace == "" {
+		return "all namespaces"
+	}
+	return namespace
+}
@@ -0,0 +1,46 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestEventWatcher_Health(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.clientset = fake.NewSimpleClientset()
+	ew.informers = make(map[string]*eventInformer)
+	ew.stopper = make(chan struct{})
+	ew.standby = true
+	ew.enrichment = newEnrichmentPool(EnrichmentConfig{QueueSize: 1})
+
+	ew.startInformer("")
+	i := ew.informers[""]
+	require.True(t, cache.WaitForCacheSync(ew.stopper, i.informer.HasSynced))
+	require.NoError(t, ew.checkReady())
+	require.Equal(t, "standby", ew.status().(watcherStatus).State)
+
+	// The informer makes no progress after the error
+	i.recordWatchError(errors.New("connection refused"))
+	require.EqualError(t, ew.checkReady(), "events in all namespaces: watch failing: connection refused")
+	require.Equal(t, "connection refused", ew.status().(watcherStatus).Informers["all namespaces"].LastWatchError)
+	i.watchErrorAt = time.Now().Add(-2 * watchErrorWindow)
+	require.NoError(t, ew.checkReady())
+
+	// A queued event without a worker picking it up
+	require.True(t, ew.busySince().IsZero())
+	ew.enrichment.lastDequeue.Store(time.Now().Add(-time.Hour).UnixNano())
+	ew.enrichment.jobs <- enrichmentJob{event: newEnrichmentTestEvent(), warm: true}
+	require.WithinDuration(t, time.Now().Add(-time.Hour), ew.busySince(), time.Second)
+
+	ew.Stop()
+	require.EqualError(t, ew.checkReady(), "stopped")
+}
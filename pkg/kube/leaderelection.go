@@ -17,6 +17,17 @@ import (
 type LeaderElectionConfig struct {
 	Enabled          bool   `yaml:"enabled"`
 	LeaderElectionID string `yaml:"leaderElectionID"`
+	// Namespace of the lease, defaults to the namespace the exporter runs in. Required when running out of cluster.
+	Namespace            string `yaml:"namespace"`
+	LeaseDurationSeconds int64  `yaml:"leaseDurationSeconds"`
+	RenewDeadlineSeconds int64  `yaml:"renewDeadlineSeconds"`
+	RetryPeriodSeconds   int64  `yaml:"retryPeriodSeconds"`
+	// ReleaseOnCancel gives up the lease on shutdown once the pending events are exported, so that another replica
+	// takes over right away instead of waiting for the lease to expire
+	ReleaseOnCancel bool `yaml:"releaseOnCancel"`
+	// Standby keeps the informers and the metadata cache of non-leaders warm, and tracks the checkpoint of the
+	// leader, so that a new leader picks up right away. Requires the checkpoint to be enabled.
+	Standby bool `yaml:"standby"`
 }
 
 const (
@@ -28,21 +39,33 @@ const (
 	defaultRetryPeriod      = 2 * time.Second
 )
 
-func GetLeaseDuration() time.Duration {
-	return defaultLeaseDuration
+func (c LeaderElectionConfig) GetLeaseDuration() time.Duration {
+	return secondsOrDefault(c.LeaseDurationSeconds, defaultLeaseDuration)
+}
+
+func (c LeaderElectionConfig) GetRenewDeadline() time.Duration {
+	return secondsOrDefault(c.RenewDeadlineSeconds, defaultRenewDeadline)
+}
+
+func (c LeaderElectionConfig) GetRetryPeriod() time.Duration {
+	return secondsOrDefault(c.RetryPeriodSeconds, defaultRetryPeriod)
+}
+
+func secondsOrDefault(seconds int64, defaultValue time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // NewResourceLock creates a new config map resource lock for use in a leader
 // election loop
-func newResourceLock(config *rest.Config, leaderElectionID string) (resourcelock.Interface, error) {
+func newResourceLock(config *rest.Config, leaderElectionID string, leaderElectionNamespace string) (resourcelock.Interface, error) {
 	if leaderElectionID == "" {
 		leaderElectionID = defaultLeaderElectionID
 	}
 
-	leaderElectionNamespace, err := getInClusterNamespace()
-	if err != nil {
-		leaderElectionNamespace = defaultNamespace
-	}
+	leaderElectionNamespace = NamespaceOrDefault(leaderElectionNamespace)
 
 	// Leader id, needs to be unique
 	id, err := os.Hostname()
@@ -67,12 +90,25 @@ func newResourceLock(config *rest.Config, leaderElectionID string) (resourcelock
 		})
 }
 
+// NamespaceOrDefault returns the namespace, or the namespace the exporter runs in if it is empty. All namespaced
+// objects of the exporter, like the leader election Lease and the checkpoint ConfigMap, default to it.
+func NamespaceOrDefault(namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	namespace, err := getInClusterNamespace()
+	if err != nil {
+		return defaultNamespace
+	}
+	return namespace
+}
+
 func getInClusterNamespace() (string, error) {
 	// Check whether the namespace file exists.
 	// If not, we are not running in cluster so can't guess the namespace.
 	_, err := os.Stat(inClusterNamespacePath)
 	if os.IsNotExist(err) {
-		return "", fmt.Errorf("not running in-cluster, please specify leaderElectionIDspace")
+		return "", fmt.Errorf("not running in-cluster, please specify leaderElection.namespace")
 	} else if err != nil {
 		return "", fmt.Errorf("error checking namespace file: %w", err)
 	}
@@ -86,17 +122,18 @@ func getInClusterNamespace() (string, error) {
 }
 
 // NewLeaderElector return  a leader elector object using client-go
-func NewLeaderElector(leaderElectionID string, config *rest.Config, startFunc func(context.Context), stopFunc func(), newLeaderFunc func(string)) (*leaderelection.LeaderElector, error) {
-	resourceLock, err := newResourceLock(config, leaderElectionID)
+func NewLeaderElector(cfg LeaderElectionConfig, config *rest.Config, startFunc func(context.Context), stopFunc func(), newLeaderFunc func(string)) (*leaderelection.LeaderElector, error) {
+	resourceLock, err := newResourceLock(config, cfg.LeaderElectionID, cfg.Namespace)
 	if err != nil {
 		return &leaderelection.LeaderElector{}, err
 	}
 
 	l, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
-		Lock:          resourceLock,
-		LeaseDuration: defaultLeaseDuration,
-		RenewDeadline: defaultRenewDeadline,
-		RetryPeriod:   defaultRetryPeriod,
+		Lock:            resourceLock,
+		LeaseDuration:   cfg.GetLeaseDuration(),
+		RenewDeadline:   cfg.GetRenewDeadline(),
+		RetryPeriod:     cfg.GetRetryPeriod(),
+		ReleaseOnCancel: cfg.ReleaseOnCancel,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: startFunc,
 			OnStoppedLeading: stopFunc,
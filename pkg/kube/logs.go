@@ -0,0 +1,149 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	defaultLogTailLines      = 20
+	defaultLogTailMaxBytes   = 4096
+	defaultLogTailsPerMinute = 10
+	defaultLogTailTimeout    = 5 * time.Second
+)
+
+var defaultLogTailReasons = []string{"BackOff", "CrashLoopBackOff", "Failed"}
+
+// LogTailConfig attaches the last lines of the container logs to failure events of pods
+type LogTailConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Reasons of the events that get the logs, defaults to BackOff, CrashLoopBackOff and Failed
+	Reasons []string `yaml:"reasons"`
+	// Lines is the number of lines from the end of the logs, defaults to 20
+	Lines int64 `yaml:"lines"`
+	// MaxBytes limits the size of the attached logs, defaults to 4096
+	MaxBytes int64 `yaml:"maxBytes"`
+	// PerMinute is the number of logs fetched per minute, further events are exported without logs. Defaults to 10.
+	PerMinute int `yaml:"perMinute"`
+	// TimeoutSeconds bounds the log requests of a single event, defaults to 5. They run after the lookup of the
+	// involved object, so that slow logs never cost an event its metadata.
+	TimeoutSeconds int64 `yaml:"timeoutSeconds"`
+}
+
+// ContainerLogs is the tail of the logs of the container an event is about
+type ContainerLogs struct {
+	Container string `json:"container,omitempty"`
+	// Previous is true if the logs belong to the previous, crashed instance of the container
+	Previous bool   `json:"previous"`
+	Tail     string `json:"tail"`
+	// Truncated is true if the tail was cut at the size limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type logTailer struct {
+	reasons   map[string]struct{}
+	lines     int64
+	maxBytes  int64
+	timeout   time.Duration
+	limiter   flowcontrol.RateLimiter
+	clientset kubernetes.Interface
+}
+
+func newLogTailer(cfg LogTailConfig, clientset kubernetes.Interface) *logTailer {
+	t := &logTailer{
+		reasons:   make(map[string]struct{}),
+		lines:     cfg.Lines,
+		maxBytes:  cfg.MaxBytes,
+		timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+		clientset: clientset,
+	}
+	if t.lines <= 0 {
+		t.lines = defaultLogTailLines
+	}
+	if t.maxBytes <= 0 {
+		t.maxBytes = defaultLogTailMaxBytes
+	}
+	if t.timeout <= 0 {
+		t.timeout = defaultLogTailTimeout
+	}
+
+	perMinute := cfg.PerMinute
+	if perMinute <= 0 {
+		perMinute = defaultLogTailsPerMinute
+	}
+	t.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(perMinute)/60, perMinute)
+
+	reasons := cfg.Reasons
+	if len(reasons) == 0 {
+		reasons = defaultLogTailReasons
+	}
+	for _, reason := range reasons {
+		t.reasons[reason] = struct{}{}
+	}
+	return t
+}
+
+// tail attaches the logs of the container to the event. The logs of the previous instance are preferred as a
+// restarted container has little to say yet.
+func (t *logTailer) tail(ctx context.Context, ev *EnhancedEvent, metricsStore *metrics.Store) {
+	if ev.InvolvedObject.Kind != "Pod" {
+		return
+	}
+	if _, ok := t.reasons[ev.Reason]; !ok {
+		return
+	}
+
+	if !t.limiter.TryAccept() {
+		log.Debug().Str("pod", ev.InvolvedObject.Name).Msg("Log tail budget exhausted, exporting event without logs")
+		metricsStore.LogTailsRateLimited.Inc()
+		return
+	}
+
+	// Without a container in the field path this only works for pods with a single container
+	container := containerFromFieldPath(ev.InvolvedObject.FieldPath)
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var err error
+	for _, previous := range []bool{true, false} {
+		var data []byte
+		data, err = t.clientset.CoreV1().
+			Pods(ev.InvolvedObject.Namespace).
+			GetLogs(ev.InvolvedObject.Name, &corev1.PodLogOptions{
+				Container:  container,
+				Previous:   previous,
+				TailLines:  &t.lines,
+				LimitBytes: &t.maxBytes,
+			}).
+			DoRaw(ctx)
+		if err == nil {
+			ev.Logs = &ContainerLogs{
+				Container: container,
+				Previous:  previous,
+				Tail:      string(data),
+				Truncated: int64(len(data)) >= t.maxBytes,
+			}
+			metricsStore.LogTailsFetched.Inc()
+			return
+		}
+	}
+
+	log.Debug().Err(err).Str("pod", ev.InvolvedObject.Name).Str("container", container).Msg("Cannot get container logs")
+}
+
+// containerFromFieldPath extracts the container name from field paths like spec.containers{app}
+func containerFromFieldPath(fieldPath string) string {
+	start := strings.Index(fieldPath, "{")
+	if start < 0 || !strings.HasSuffix(fieldPath, "}") {
+		return ""
+	}
+	return fieldPath[start+1 : len(fieldPath)-1]
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newLogTailTestEvent(reason string) *EnhancedEvent {
+	ev := &EnhancedEvent{}
+	ev.Reason = reason
+	ev.InvolvedObject.ObjectReference = corev1.ObjectReference{
+		Kind:      "Pod",
+		Namespace: "default",
+		Name:      "web-1",
+		FieldPath: "spec.containers{app}",
+	}
+	return ev
+}
+
+func TestLogTailer(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	clientset := fake.NewSimpleClientset()
+	tailer := newLogTailer(LogTailConfig{Enabled: true, Lines: 5, PerMinute: 2}, clientset)
+
+	ev := newLogTailTestEvent("BackOff")
+	tailer.tail(context.Background(), ev, metricsStore)
+	require.Equal(t, &ContainerLogs{Container: "app", Previous: true, Tail: "fake logs"}, ev.Logs)
+
+	require.Len(t, clientset.Actions(), 1)
+	options := clientset.Actions()[0].(clienttesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+	require.Equal(t, int64(5), *options.TailLines)
+	require.Equal(t, int64(defaultLogTailMaxBytes), *options.LimitBytes)
+
+	// Other reasons and kinds are left alone
+	ev = newLogTailTestEvent("Pulled")
+	tailer.tail(context.Background(), ev, metricsStore)
+	require.Nil(t, ev.Logs)
+	ev = newLogTailTestEvent("BackOff")
+	ev.InvolvedObject.Kind = "Node"
+	tailer.tail(context.Background(), ev, metricsStore)
+	require.Nil(t, ev.Logs)
+
+	// The budget allows two fetches per minute
+	tailer.tail(context.Background(), newLogTailTestEvent("Failed"), metricsStore)
+	ev = newLogTailTestEvent("Failed")
+	tailer.tail(context.Background(), ev, metricsStore)
+	require.Nil(t, ev.Logs)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.LogTailsFetched))
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.LogTailsRateLimited))
+}
+
+func TestContainerFromFieldPath(t *testing.T) {
+	require.Equal(t, "app", containerFromFieldPath("spec.containers{app}"))
+	require.Equal(t, "init", containerFromFieldPath("spec.initContainers{init}"))
+	require.Equal(t, "", containerFromFieldPath(""))
+	require.Equal(t, "", containerFromFieldPath("spec.containers"))
+}
@@ -0,0 +1,250 @@
+package kube
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var defaultMetadataInformerKinds = []string{"Pod", "Node", "Deployment.apps", "ReplicaSet.apps"}
+
+// metadataInformerSyncWait is how long a lookup waits for an informer that was just started, e.g. for a namespace
+// that started matching the namespace selector, before looking the object up with a GET
+const metadataInformerSyncWait = 2 * time.Second
+
+// MetadataInformersConfig serves the metadata of frequently involved kinds from a watch instead of a GET per object
+type MetadataInformersConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Kinds are given as Kind.group, e.g. Deployment.apps. Defaults to Pod, Node, Deployment.apps and ReplicaSet.apps.
+	Kinds []string `yaml:"kinds"`
+}
+
+// metadataInformerKey identifies the informer of a kind in a namespace. Cluster scoped kinds, and namespaced kinds
+// watched in all namespaces, have an empty namespace.
+type metadataInformerKey struct {
+	gk        schema.GroupKind
+	namespace string
+}
+
+type metadataKind struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+type metadataInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// informerMetadataProvider looks up objects in the stores of metadata-only informers. Objects of other kinds, and
+// objects the informers have not seen yet, are looked up by the fallback provider.
+type informerMetadataProvider struct {
+	client metadata.Interface
+	// kinds is filled before the event informers start and read-only afterwards
+	kinds        map[schema.GroupKind]metadataKind
+	onWatchError func()
+	fallback     ObjectMetadataProvider
+
+	mu        sync.RWMutex
+	informers map[metadataInformerKey]*metadataInformer
+}
+
+var _ ObjectMetadataProvider = &informerMetadataProvider{}
+
+func newInformerMetadataProvider(client metadata.Interface, fallback ObjectMetadataProvider) *informerMetadataProvider {
+	return &informerMetadataProvider{
+		client:       client,
+		kinds:        make(map[schema.GroupKind]metadataKind),
+		onWatchError: func() {},
+		fallback:     fallback,
+		informers:    make(map[metadataInformerKey]*metadataInformer),
+	}
+}
+
+func (p *informerMetadataProvider) GetObjectMetadata(ctx context.Context, reference *v1.ObjectReference, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error) {
+	gk := schema.FromAPIVersionAndKind(reference.APIVersion, reference.Kind).GroupKind()
+	if informer := p.informerFor(gk, reference.Namespace); informer != nil {
+		// Lookups wait for the initial list of the informer instead of turning into a GET for every object
+		if !informer.HasSynced() && !waitForMetadataSync(ctx, informer) {
+			log.Debug().Str("kind", reference.Kind).Str("namespace", reference.Namespace).
+				Msg("Metadata informer has not synced in time, falling back to a lookup")
+			return p.fallback.GetObjectMetadata(ctx, reference, dynClient, metricsStore)
+		}
+
+		key := reference.Name
+		if reference.Namespace != "" {
+			key = reference.Namespace + "/" + reference.Name
+		}
+
+		obj, exists, err := informer.GetStore().GetByKey(key)
+		if item, ok := obj.(*metav1.PartialObjectMetadata); err == nil && exists && ok {
+			metricsStore.MetadataInformerHits.Inc()
+			return ObjectMetadata{
+				OwnerReferences: item.OwnerReferences,
+				Labels:          item.Labels,
+				Annotations:     item.Annotations,
+				Deleted:         item.DeletionTimestamp != nil,
+			}, nil
+		}
+	}
+
+	return p.fallback.GetObjectMetadata(ctx, reference, dynClient, metricsStore)
+}
+
+func waitForMetadataSync(ctx context.Context, informer cache.SharedIndexInformer) bool {
+	ctx, cancel := context.WithTimeout(ctx, metadataInformerSyncWait)
+	defer cancel()
+	return cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
+}
+
+// informerFor returns the informer holding the objects of the kind in the namespace, if any
+func (p *informerMetadataProvider) informerFor(gk schema.GroupKind, namespace string) cache.SharedIndexInformer {
+	kind, ok := p.kinds[gk]
+	if !ok {
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if kind.namespaced {
+		if i, ok := p.informers[metadataInformerKey{gk: gk, namespace: namespace}]; ok {
+			return i.informer
+		}
+	}
+	if i, ok := p.informers[metadataInformerKey{gk: gk}]; ok {
+		return i.informer
+	}
+	return nil
+}
+
+// addKind watches the metadata of the kind once its informers are started
+func (p *informerMetadataProvider) addKind(gk schema.GroupKind, gvr schema.GroupVersionResource, namespaced bool) {
+	p.kinds[gk] = metadataKind{gvr: gvr, namespaced: namespaced}
+}
+
+// startClusterScoped runs the informers of the cluster scoped kinds
+func (p *informerMetadataProvider) startClusterScoped(wg *sync.WaitGroup) []cache.InformerSynced {
+	return p.start(wg, "", false)
+}
+
+// startNamespace runs the informers of the namespaced kinds in the namespace, or in all namespaces if it is empty
+func (p *informerMetadataProvider) startNamespace(wg *sync.WaitGroup, namespace string) []cache.InformerSynced {
+	return p.start(wg, namespace, true)
+}
+
+func (p *informerMetadataProvider) start(wg *sync.WaitGroup, namespace string, namespaced bool) []cache.InformerSynced {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	synced := make([]cache.InformerSynced, 0)
+	for gk, kind := range p.kinds {
+		key := metadataInformerKey{gk: gk, namespace: namespace}
+		if _, ok := p.informers[key]; ok || kind.namespaced != namespaced {
+			continue
+		}
+
+		i := &metadataInformer{informer: p.newInformer(kind.gvr, namespace), stopCh: make(chan struct{})}
+		p.informers[key] = i
+		synced = append(synced, i.informer.HasSynced)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.informer.Run(i.stopCh)
+		}()
+	}
+	return synced
+}
+
+// stopNamespace stops the informers of the namespaced kinds in the namespace
+func (p *informerMetadataProvider) stopNamespace(namespace string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, i := range p.informers {
+		if key.namespace == namespace && p.kinds[key.gk].namespaced {
+			close(i.stopCh)
+			delete(p.informers, key)
+		}
+	}
+}
+
+func (p *informerMetadataProvider) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, i := range p.informers {
+		close(i.stopCh)
+		delete(p.informers, key)
+	}
+}
+
+// newInformer creates a metadata informer for the resource in the namespace, or in all namespaces if it is empty
+func (p *informerMetadataProvider) newInformer(gvr schema.GroupVersionResource, namespace string) cache.SharedIndexInformer {
+	informer := metadatainformer.NewFilteredMetadataInformer(p.client, gvr, namespace, 0, cache.Indexers{}, nil).Informer()
+	// Managed fields are never exported and make up most of the metadata
+	_ = informer.SetTransform(func(obj interface{}) (interface{}, error) {
+		if item, ok := obj.(*metav1.PartialObjectMetadata); ok {
+			item.ManagedFields = nil
+		}
+		return obj, nil
+	})
+	_ = informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		p.onWatchError()
+	})
+	return informer
+}
+
+// startMetadataInformers sets up a metadata informer for each configured kind. Kinds that cannot be mapped to a
+// resource are looked up with GETs. Namespaced kinds are only watched in the watched namespaces: in the namespaces of
+// the include list, or along with the per namespace event informers. The informers started here are synced before
+// any event is received.
+func (e *EventWatcher) startMetadataInformers() {
+	kinds := e.metadataKinds
+	if len(kinds) == 0 {
+		kinds = defaultMetadataInformerKinds
+	}
+
+	e.metadataInformers.onWatchError = func() {
+		e.metricsStore.WatchErrors.Inc()
+	}
+	for _, kind := range kinds {
+		gk := schema.ParseGroupKind(kind)
+		mapping, err := e.restMapper.RESTMapping(gk)
+		if err != nil {
+			log.Error().Err(err).Str("kind", kind).Msg("Cannot watch the metadata of kind, falling back to lookups")
+			continue
+		}
+
+		namespaced := mapping.Scope == nil || mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		e.metadataInformers.addKind(gk, mapping.Resource, namespaced)
+		log.Info().Str("kind", kind).Msg("Watching object metadata")
+	}
+
+	synced := e.metadataInformers.startClusterScoped(&e.wg)
+	switch {
+	case e.perNamespace:
+		// startInformer runs the informers of the namespaced kinds next to the event informer of each namespace
+	case e.namespaces != nil && len(e.namespaces.include) > 0:
+		for namespace := range e.namespaces.include {
+			if e.namespaces.matchesLists(namespace) {
+				synced = append(synced, e.metadataInformers.startNamespace(&e.wg, namespace)...)
+			}
+		}
+	default:
+		synced = append(synced, e.metadataInformers.startNamespace(&e.wg, "")...)
+	}
+
+	cache.WaitForNamedCacheSync("object metadata", e.stopper, synced...)
+}
@@ -0,0 +1,80 @@
+package kube
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakemetadata "k8s.io/client-go/metadata/fake"
+)
+
+func TestInformerMetadataProvider(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	now := metav1.Now()
+	scheme := fakemetadata.NewTestScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	client := fakemetadata.NewSimpleMetadataClient(scheme,
+		&metav1.PartialObjectMetadata{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "web-1",
+				Labels:      map[string]string{"app": "web"},
+				Annotations: map[string]string{"note": "x"},
+			},
+		},
+		&metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-2", DeletionTimestamp: &now},
+		},
+	)
+
+	fallback := mapObjectMetadataProvider{
+		"svc":   {Labels: map[string]string{"from": "fallback"}},
+		"other": {Labels: map[string]string{"from": "fallback"}},
+	}
+	provider := newInformerMetadataProvider(client, fallback)
+	provider.addKind(schema.GroupKind{Kind: "Pod"}, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, true)
+
+	// Lookups wait for the informer to sync
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer provider.stop()
+	require.Len(t, provider.startNamespace(&wg, "default"), 1)
+
+	metadata, err := provider.GetObjectMetadata(context.Background(), &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web-1"}, nil, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"app": "web"}, metadata.Labels)
+	require.Equal(t, map[string]string{"note": "x"}, metadata.Annotations)
+	require.False(t, metadata.Deleted)
+
+	metadata, err = provider.GetObjectMetadata(context.Background(), &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web-2"}, nil, metricsStore)
+	require.NoError(t, err)
+	require.True(t, metadata.Deleted)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.MetadataInformerHits))
+
+	// Other kinds and unknown objects are looked up by the fallback
+	metadata, err = provider.GetObjectMetadata(context.Background(), &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "web", UID: "svc"}, nil, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"from": "fallback"}, metadata.Labels)
+
+	_, err = provider.GetObjectMetadata(context.Background(), &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web-3", UID: "web-3"}, nil, metricsStore)
+	require.Error(t, err)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.MetadataInformerHits))
+
+	// Namespaces without an informer are not watched
+	metadata, err = provider.GetObjectMetadata(context.Background(), &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "kube-system", Name: "web-1", UID: "other"}, nil, metricsStore)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"from": "fallback"}, metadata.Labels)
+
+	provider.stopNamespace("default")
+	require.Nil(t, provider.informerFor(schema.GroupKind{Kind: "Pod"}, "default"))
+}
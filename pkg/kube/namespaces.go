@@ -0,0 +1,113 @@
+package kube
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespacesConfig selects the namespaces whose events are watched. An empty config watches all namespaces.
+type NamespacesConfig struct {
+	// Include lists the watched namespaces, all namespaces are watched if empty
+	Include []string `yaml:"include"`
+	// Exclude lists namespaces that are never watched
+	Exclude []string `yaml:"exclude"`
+	// LabelSelector restricts the watched namespaces to the ones with matching labels, e.g. "team=payments".
+	// It is re-evaluated as namespaces are created or relabeled.
+	LabelSelector string `yaml:"labelSelector"`
+	// PerNamespaceInformers runs one informer per watched namespace instead of a single cluster wide informer.
+	// This is required if the exporter is not allowed to list and watch events in all namespaces.
+	PerNamespaceInformers bool `yaml:"perNamespaceInformers"`
+}
+
+// IsEmpty returns true if all namespaces are watched
+func (c NamespacesConfig) IsEmpty() bool {
+	return len(c.Include) == 0 && len(c.Exclude) == 0 && c.LabelSelector == ""
+}
+
+// namespaceFilter decides whether the events of a namespace are watched
+type namespaceFilter struct {
+	include map[string]struct{}
+	exclude map[string]struct{}
+	// lister only contains the namespaces matching the label selector, it is nil without a selector
+	lister listerscorev1.NamespaceLister
+}
+
+func newNamespaceFilter(cfg NamespacesConfig) *namespaceFilter {
+	f := &namespaceFilter{
+		include: make(map[string]struct{}, len(cfg.Include)),
+		exclude: make(map[string]struct{}, len(cfg.Exclude)),
+	}
+	for _, ns := range cfg.Include {
+		f.include[ns] = struct{}{}
+	}
+	for _, ns := range cfg.Exclude {
+		f.exclude[ns] = struct{}{}
+	}
+	return f
+}
+
+// matchesLists checks the include and exclude lists only
+func (f *namespaceFilter) matchesLists(namespace string) bool {
+	if _, ok := f.exclude[namespace]; ok {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	_, ok := f.include[namespace]
+	return ok
+}
+
+func (f *namespaceFilter) isWatched(namespace string) bool {
+	if f == nil {
+		return true
+	}
+	if !f.matchesLists(namespace) {
+		return false
+	}
+	if f.lister == nil {
+		return true
+	}
+	_, err := f.lister.Get(namespace)
+	return err == nil
+}
+
+// newNamespaceInformer watches the namespaces matching the label selector. The API server reports namespaces that
+// stop matching the selector as deleted, so the store always contains exactly the matching namespaces.
+func newNamespaceInformer(clientset kubernetes.Interface, labelSelector string) cache.SharedIndexInformer {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+		}))
+	return factory.Core().V1().Namespaces().Informer()
+}
+
+// namespaceHandler starts and stops the per namespace informers as namespaces start or stop matching the selector
+type namespaceHandler struct {
+	watcher *EventWatcher
+}
+
+func (h namespaceHandler) OnAdd(obj interface{}) {
+	if ns, ok := obj.(*corev1.Namespace); ok && h.watcher.namespaces.matchesLists(ns.Name) {
+		h.watcher.startInformer(ns.Name)
+	}
+}
+
+func (h namespaceHandler) OnUpdate(_, _ interface{}) {
+	// The selector is evaluated by the API server, matching namespaces are added and others deleted
+}
+
+func (h namespaceHandler) OnDelete(obj interface{}) {
+	switch ns := obj.(type) {
+	case *corev1.Namespace:
+		h.watcher.stopInformer(ns.Name)
+	case cache.DeletedFinalStateUnknown:
+		if ns, ok := ns.Obj.(*corev1.Namespace); ok {
+			h.watcher.stopInformer(ns.Name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespaceFilter_NilWatchesEverything(t *testing.T) {
+	var f *namespaceFilter
+	require.True(t, f.isWatched("default"))
+}
+
+func TestNamespaceFilter_Lists(t *testing.T) {
+	f := newNamespaceFilter(NamespacesConfig{
+		Include: []string{"payments", "orders", "kube-system"},
+		Exclude: []string{"kube-system"},
+	})
+
+	require.True(t, f.isWatched("payments"))
+	require.True(t, f.isWatched("orders"))
+	require.False(t, f.isWatched("kube-system"))
+	require.False(t, f.isWatched("default"))
+}
+
+func TestNamespaceFilter_ExcludeOnly(t *testing.T) {
+	f := newNamespaceFilter(NamespacesConfig{Exclude: []string{"kube-system"}})
+
+	require.True(t, f.isWatched("default"))
+	require.False(t, f.isWatched("kube-system"))
+}
+
+func TestNamespaceFilter_LabelSelector(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	// The informer only stores the namespaces matching the selector
+	require.NoError(t, indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}}))
+	require.NoError(t, indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments-staging"}}))
+
+	f := newNamespaceFilter(NamespacesConfig{Exclude: []string{"payments-staging"}, LabelSelector: "team=payments"})
+	f.lister = listerscorev1.NewNamespaceLister(indexer)
+
+	require.True(t, f.isWatched("payments"))
+	require.False(t, f.isWatched("payments-staging"))
+	require.False(t, f.isWatched("orders"))
+}
@@ -3,23 +3,49 @@ package kube
 import (
 	"context"
 	"strings"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/restmapper"
 )
 
+// unversionedMetadataTTL is how long the metadata of objects looked up without a resource version, like the owners
+// in the owner chain, is served from the cache. Their cache key does not change when they are updated.
+const unversionedMetadataTTL = time.Minute
+
 type ObjectMetadataProvider interface {
-	GetObjectMetadata(reference *v1.ObjectReference, clientset *kubernetes.Clientset, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error)
+	GetObjectMetadata(ctx context.Context, reference *v1.ObjectReference, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error)
+}
+
+// RESTMapper is the part of meta.RESTMapper needed to look up objects by kind
+type RESTMapper interface {
+	RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error)
 }
 
 type ObjectMetadataCache struct {
-	cache *lru.ARCCache
+	cache  *lru.ARCCache
+	mapper RESTMapper
+	// notFound remembers the objects that did not exist, so that a burst of events about a deleted object does not
+	// turn into a burst of lookups
+	notFound    *lru.Cache
+	notFoundTTL time.Duration
+	now         func() time.Time
+}
+
+type cachedMetadata struct {
+	metadata  ObjectMetadata
+	fetchedAt time.Time
+}
+
+type notFoundEntry struct {
+	err   error
+	until time.Time
 }
 
 var _ ObjectMetadataProvider = &ObjectMetadataCache{}
@@ -31,26 +57,48 @@ type ObjectMetadata struct {
 	Deleted         bool
 }
 
-func NewObjectMetadataProvider(size int) ObjectMetadataProvider {
+// NewObjectMetadataProvider creates a provider resolving the kinds of the involved objects with the mapper, which
+// should be cached as it is used on every cache miss. Objects that are not found are remembered for notFoundTTL.
+func NewObjectMetadataProvider(size int, mapper RESTMapper, notFoundTTL time.Duration) ObjectMetadataProvider {
 	cache, err := lru.NewARC(size)
 	if err != nil {
 		panic("cannot init cache: " + err.Error())
 	}
+	notFound, err := lru.New(size)
+	if err != nil {
+		panic("cannot init cache: " + err.Error())
+	}
 
 	var o ObjectMetadataProvider = &ObjectMetadataCache{
-		cache: cache,
+		cache:       cache,
+		mapper:      mapper,
+		notFound:    notFound,
+		notFoundTTL: notFoundTTL,
+		now:         time.Now,
 	}
 
 	return o
 }
 
-func (o *ObjectMetadataCache) GetObjectMetadata(reference *v1.ObjectReference, clientset *kubernetes.Clientset, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error) {
+func (o *ObjectMetadataCache) GetObjectMetadata(ctx context.Context, reference *v1.ObjectReference, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error) {
 	// ResourceVersion changes when the object is updated.
 	// We use "UID/ResourceVersion" as cache key so that if the object is updated we get the new metadata.
 	cacheKey := strings.Join([]string{string(reference.UID), reference.ResourceVersion}, "/")
 	if val, ok := o.cache.Get(cacheKey); ok {
-		metricsStore.KubeApiReadCacheHits.Inc()
-		return val.(ObjectMetadata), nil
+		entry := val.(cachedMetadata)
+		if reference.ResourceVersion != "" || o.now().Sub(entry.fetchedAt) < unversionedMetadataTTL {
+			metricsStore.KubeApiReadCacheHits.Inc()
+			return entry.metadata, nil
+		}
+		o.cache.Remove(cacheKey)
+	}
+	if val, ok := o.notFound.Get(cacheKey); ok {
+		entry := val.(notFoundEntry)
+		if o.now().Before(entry.until) {
+			metricsStore.KubeApiReadCacheHits.Inc()
+			return ObjectMetadata{}, entry.err
+		}
+		o.notFound.Remove(cacheKey)
 	}
 
 	var group, version string
@@ -65,13 +113,7 @@ func (o *ObjectMetadataCache) GetObjectMetadata(reference *v1.ObjectReference, c
 
 	gk := schema.GroupKind{Group: group, Kind: reference.Kind}
 
-	groupResources, err := restmapper.GetAPIGroupResources(clientset.Discovery())
-	if err != nil {
-		return ObjectMetadata{}, err
-	}
-
-	rm := restmapper.NewDiscoveryRESTMapper(groupResources)
-	mapping, err := rm.RESTMapping(gk, version)
+	mapping, err := o.mapper.RESTMapping(gk, version)
 	if err != nil {
 		return ObjectMetadata{}, err
 	}
@@ -79,11 +121,14 @@ func (o *ObjectMetadataCache) GetObjectMetadata(reference *v1.ObjectReference, c
 	item, err := dynClient.
 		Resource(mapping.Resource).
 		Namespace(reference.Namespace).
-		Get(context.Background(), reference.Name, metav1.GetOptions{})
+		Get(ctx, reference.Name, metav1.GetOptions{})
 
 	metricsStore.KubeApiReadRequests.Inc()
 
 	if err != nil {
+		if errors.IsNotFound(err) && o.notFoundTTL > 0 {
+			o.notFound.Add(cacheKey, notFoundEntry{err: err, until: o.now().Add(o.notFoundTTL)})
+		}
 		return ObjectMetadata{}, err
 	}
 
@@ -97,6 +142,6 @@ func (o *ObjectMetadataCache) GetObjectMetadata(reference *v1.ObjectReference, c
 		objectMetadata.Deleted = true
 	}
 
-	o.cache.Add(cacheKey, objectMetadata)
+	o.cache.Add(cacheKey, cachedMetadata{metadata: objectMetadata, fetchedAt: o.now()})
 	return objectMetadata, nil
 }
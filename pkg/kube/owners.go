@@ -0,0 +1,85 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const defaultOwnerChainMaxDepth = 5
+
+// OwnerChainConfig enables resolving the controllers of the involved object up to the top level workload,
+// e.g. Pod -> ReplicaSet -> Deployment or Pod -> Job -> CronJob
+type OwnerChainConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxDepth limits the number of owners looked up per event, defaults to 5
+	MaxDepth int `yaml:"maxDepth"`
+}
+
+// OwnerInfo is one of the controllers in the owner chain of an object
+type OwnerInfo struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	UID        types.UID         `json:"uid"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// controllerOf returns the owner reference which is the managing controller, if any
+func controllerOf(owners []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range owners {
+		if owners[i].Controller != nil && *owners[i].Controller {
+			return &owners[i]
+		}
+	}
+	return nil
+}
+
+// resolveOwnerChain walks the controller owner references starting from the owners of the involved object. Owner
+// metadata is served from the same cache as the involved objects. Owner references carry no resource version, so
+// owners are cached by UID and looked up again after unversionedMetadataTTL to pick up changed labels.
+func (e *EventWatcher) resolveOwnerChain(ctx context.Context, namespace string, owners []metav1.OwnerReference) []OwnerInfo {
+	maxDepth := e.ownerChain.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultOwnerChainMaxDepth
+	}
+
+	chain := make([]OwnerInfo, 0)
+	for len(chain) < maxDepth {
+		owner := controllerOf(owners)
+		if owner == nil {
+			break
+		}
+
+		info := OwnerInfo{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			UID:        owner.UID,
+		}
+
+		reference := &corev1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			Namespace:  namespace,
+			UID:        owner.UID,
+		}
+		metadata, err := e.objectMetadataCache.GetObjectMetadata(ctx, reference, e.dynamicClient, e.metricsStore)
+		if err != nil {
+			// The owner is still part of the chain, but we cannot go any further
+			log.Debug().Err(err).Str("kind", owner.Kind).Str("name", owner.Name).Msg("Cannot get owner metadata")
+			chain = append(chain, info)
+			break
+		}
+
+		info.Labels = metadata.Labels
+		chain = append(chain, info)
+		owners = metadata.OwnerReferences
+	}
+
+	return chain
+}
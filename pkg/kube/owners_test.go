@@ -0,0 +1,85 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// mapObjectMetadataProvider serves the metadata of the objects by UID
+type mapObjectMetadataProvider map[types.UID]ObjectMetadata
+
+func (m mapObjectMetadataProvider) GetObjectMetadata(_ context.Context, reference *corev1.ObjectReference, _ dynamic.Interface, _ *metrics.Store) (ObjectMetadata, error) {
+	if val, ok := m[reference.UID]; ok {
+		return val, nil
+	}
+	return ObjectMetadata{}, errors.NewNotFound(schema.GroupResource{}, reference.Name)
+}
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{
+		{Kind: "Other", Name: "not-a-controller", UID: "other"},
+		{APIVersion: "apps/v1", Kind: kind, Name: name, UID: types.UID(name), Controller: &controller},
+	}
+}
+
+func TestOnEvent_OwnerChain(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.ownerChain = OwnerChainConfig{Enabled: true}
+	ew.objectMetadataCache = mapObjectMetadataProvider{
+		"pod":     {OwnerReferences: controllerRef("ReplicaSet", "web-123")},
+		"web-123": {Labels: map[string]string{"pod-template-hash": "123"}, OwnerReferences: controllerRef("Deployment", "web")},
+		"web":     {Labels: map[string]string{"team": "payments"}},
+	}
+
+	event := EnhancedEvent{}
+	ew.fn = func(e *EnhancedEvent) {
+		event = *e
+	}
+
+	ew.onEvent(&corev1.Event{
+		LastTimestamp:  metav1.Time{Time: time.Now()},
+		InvolvedObject: corev1.ObjectReference{UID: "pod", Name: "web-123-abc", Kind: "Pod"},
+	})
+
+	require.Len(t, event.InvolvedObject.OwnerChain, 2)
+	require.Equal(t, "ReplicaSet", event.InvolvedObject.OwnerChain[0].Kind)
+	require.Equal(t, OwnerInfo{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "web",
+		UID:        "web",
+		Labels:     map[string]string{"team": "payments"},
+	}, event.InvolvedObject.TopLevelOwner())
+}
+
+func TestResolveOwnerChain_MissingOwnerAndMaxDepth(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.objectMetadataCache = mapObjectMetadataProvider{
+		"job": {OwnerReferences: controllerRef("CronJob", "backup")},
+	}
+
+	// The CronJob is gone, it still ends the chain
+	chain := ew.resolveOwnerChain(context.Background(), "default", controllerRef("Job", "job"))
+	require.Len(t, chain, 2)
+	require.Equal(t, "backup", chain[1].Name)
+
+	ew.ownerChain.MaxDepth = 1
+	chain = ew.resolveOwnerChain(context.Background(), "default", controllerRef("Job", "job"))
+	require.Len(t, chain, 1)
+	require.Equal(t, "job", chain[0].Name)
+}
@@ -0,0 +1,163 @@
+package kube
+
+import (
+	"sync"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultDiscoveryRefreshSeconds = 600
+	// minDiscoveryResetInterval keeps lookups of kinds that really do not exist from hammering the API server
+	minDiscoveryResetInterval = 30 * time.Second
+)
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// DiscoveryConfig controls how the API discovery used to look up involved objects is cached
+type DiscoveryConfig struct {
+	// RefreshIntervalSeconds is how often the cached discovery is dropped, defaults to 600
+	RefreshIntervalSeconds int64 `yaml:"refreshIntervalSeconds"`
+	// WatchCRDs drops the cached discovery as soon as a CustomResourceDefinition is added, changed or removed.
+	// The exporter needs permission to list and watch customresourcedefinitions.
+	WatchCRDs bool `yaml:"watchCRDs"`
+}
+
+// CachedRESTMapper maps kinds to resources using a discovery cache that is shared by all metadata lookups. The
+// cache is rebuilt lazily after it is reset, which happens periodically, when CRDs change and when a kind is unknown.
+type CachedRESTMapper struct {
+	mapper       *restmapper.DeferredDiscoveryRESTMapper
+	metricsStore *metrics.Store
+
+	mu        sync.Mutex
+	lastReset time.Time
+	now       func() time.Time
+}
+
+func NewCachedRESTMapper(client discovery.DiscoveryInterface, metricsStore *metrics.Store) *CachedRESTMapper {
+	return &CachedRESTMapper{
+		mapper:       restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client)),
+		metricsStore: metricsStore,
+		now:          time.Now,
+	}
+}
+
+// RESTMapping returns the mapping of the kind. An unknown kind may belong to a CRD installed after the discovery was
+// cached, so the cache is reset and the lookup retried once.
+func (m *CachedRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mapping, err := m.mapper.RESTMapping(gk, versions...)
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+
+	if !m.reset(false) {
+		return nil, err
+	}
+	log.Debug().Str("kind", gk.String()).Msg("Unknown kind, refreshed the API discovery")
+	return m.mapper.RESTMapping(gk, versions...)
+}
+
+// Reset drops the cached discovery, it is fetched again on the next lookup
+func (m *CachedRESTMapper) Reset() {
+	m.reset(true)
+}
+
+func (m *CachedRESTMapper) reset(force bool) bool {
+	m.mu.Lock()
+	now := m.now()
+	if !force && now.Sub(m.lastReset) < minDiscoveryResetInterval {
+		m.mu.Unlock()
+		return false
+	}
+	m.lastReset = now
+	m.mu.Unlock()
+
+	m.mapper.Reset()
+	m.metricsStore.DiscoveryRefreshes.Inc()
+	return true
+}
+
+// Run resets the cache every interval until the stop channel is closed
+func (m *CachedRESTMapper) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Reset()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// newCRDInformer resets the mapper whenever a CustomResourceDefinition changes. CRDs created before the informer
+// started are part of the initial list and ignored, as are relists delivering unchanged objects.
+func newCRDInformer(client dynamic.Interface, mapper *CachedRESTMapper) cache.SharedIndexInformer {
+	informer := dynamicinformer.NewFilteredDynamicInformer(client, crdResource, "", 0, cache.Indexers{}, nil).Informer()
+	startedAt := time.Now()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if crd, ok := obj.(*unstructured.Unstructured); ok && crd.GetCreationTimestamp().After(startedAt) {
+				mapper.Reset()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCRD, ok := oldObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if newCRD, ok := newObj.(*unstructured.Unstructured); ok && oldCRD.GetResourceVersion() != newCRD.GetResourceVersion() {
+				mapper.Reset()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			mapper.Reset()
+		},
+	})
+	return informer
+}
+
+// runRESTMapper refreshes the discovery cache of the metadata lookups in the background
+func (e *EventWatcher) runRESTMapper() {
+	interval := e.discovery.RefreshIntervalSeconds
+	if interval == 0 {
+		interval = defaultDiscoveryRefreshSeconds
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.restMapper.Run(time.Second*time.Duration(interval), e.stopper)
+	}()
+
+	if e.discovery.WatchCRDs {
+		informer := newCRDInformer(e.dynamicClient, e.restMapper)
+		informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			e.metricsStore.WatchErrors.Inc()
+		})
+
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			informer.Run(e.stopper)
+		}()
+	}
+}
@@ -0,0 +1,79 @@
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newFakeDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{
+		Fake: &clienttesting.Fake{
+			Resources: []*metav1.APIResourceList{
+				{
+					GroupVersion: "v1",
+					APIResources: []metav1.APIResource{{Name: "pods", Kind: "Pod", Namespaced: true}},
+				},
+			},
+		},
+	}
+}
+
+func TestCachedRESTMapper_CachesDiscovery(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	client := newFakeDiscovery()
+	mapper := NewCachedRESTMapper(client, metricsStore)
+
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Kind: "Pod"}, "v1")
+	require.NoError(t, err)
+	require.Equal(t, "pods", mapping.Resource.Resource)
+	discoveryCalls := len(client.Actions())
+	require.NotZero(t, discoveryCalls)
+
+	_, err = mapper.RESTMapping(schema.GroupKind{Kind: "Pod"}, "v1")
+	require.NoError(t, err)
+	require.Len(t, client.Actions(), discoveryCalls)
+
+	mapper.Reset()
+	_, err = mapper.RESTMapping(schema.GroupKind{Kind: "Pod"}, "v1")
+	require.NoError(t, err)
+	require.Greater(t, len(client.Actions()), discoveryCalls)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.DiscoveryRefreshes))
+}
+
+func TestCachedRESTMapper_UnknownKind(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	client := newFakeDiscovery()
+	mapper := NewCachedRESTMapper(client, metricsStore)
+	now := time.Now()
+	mapper.now = func() time.Time { return now }
+
+	widget := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	_, err := mapper.RESTMapping(widget, "v1")
+	require.Error(t, err)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.DiscoveryRefreshes))
+
+	// The CRD is installed, but the discovery is not refreshed again right away
+	client.Resources = append(client.Resources, &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true}},
+	})
+	_, err = mapper.RESTMapping(widget, "v1")
+	require.Error(t, err)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.DiscoveryRefreshes))
+
+	now = now.Add(minDiscoveryResetInterval)
+	mapping, err := mapper.RESTMapping(widget, "v1")
+	require.NoError(t, err)
+	require.Equal(t, "widgets", mapping.Resource.Resource)
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.DiscoveryRefreshes))
+}
@@ -0,0 +1,158 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const selectorStatsInterval = 5 * time.Minute
+
+// EventSelectorConfig is pushed to the API server so that unwanted events never reach the exporter. Unlike route
+// rules the values are compared for equality, not as regular expressions.
+type EventSelectorConfig struct {
+	Type               string `yaml:"type"`
+	Reason             string `yaml:"reason"`
+	InvolvedObjectKind string `yaml:"involvedObjectKind"`
+	// Source is the component reporting the event, e.g. kubelet
+	Source string `yaml:"source"`
+	// FieldSelector is added as is, e.g. "involvedObject.name=my-pod,reason!=Pulled"
+	FieldSelector string `yaml:"fieldSelector"`
+	// LabelSelector selects on the labels of the events themselves, not of the involved objects
+	LabelSelector string `yaml:"labelSelector"`
+}
+
+// IsEmpty returns true if no selector is configured
+func (c EventSelectorConfig) IsEmpty() bool {
+	return c.FieldSelector == "" && c.LabelSelector == "" && c.Type == "" && c.Reason == "" &&
+		c.InvolvedObjectKind == "" && c.Source == ""
+}
+
+// BuildFieldSelector returns the field selector for the given events API version. The field names differ between
+// core/v1 and events.k8s.io/v1.
+func (c EventSelectorConfig) BuildFieldSelector(eventsAPI string) (string, error) {
+	kindField, sourceField := "involvedObject.kind", "source"
+	if eventsAPI == EventsAPIEventsV1 {
+		kindField, sourceField = "regarding.kind", "reportingController"
+	}
+
+	selectors := make([]fields.Selector, 0)
+	for _, v := range [][2]string{
+		{"type", c.Type},
+		{"reason", c.Reason},
+		{kindField, c.InvolvedObjectKind},
+		{sourceField, c.Source},
+	} {
+		if v[1] != "" {
+			selectors = append(selectors, fields.OneTermEqualSelector(v[0], v[1]))
+		}
+	}
+
+	if c.FieldSelector != "" {
+		selector, err := fields.ParseSelector(c.FieldSelector)
+		if err != nil {
+			return "", err
+		}
+		selectors = append(selectors, selector)
+	}
+
+	parts := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (e *EventWatcher) tweakListOptions(options *metav1.ListOptions) {
+	options.FieldSelector = e.fieldSelector
+	options.LabelSelector = e.labelSelector
+}
+
+// countEvents returns the number of events in the namespace without any selector. It only requests a single item
+// and relies on the remaining item count reported by the API server.
+func (e *EventWatcher) countEvents(ctx context.Context, namespace string) (int64, error) {
+	options := metav1.ListOptions{Limit: 1}
+
+	var listMeta metav1.ListMeta
+	var items int
+	if e.eventsAPI == EventsAPIEventsV1 {
+		list, err := e.clientset.EventsV1().Events(namespace).List(ctx, options)
+		if err != nil {
+			return 0, err
+		}
+		listMeta, items = list.ListMeta, len(list.Items)
+	} else {
+		list, err := e.clientset.CoreV1().Events(namespace).List(ctx, options)
+		if err != nil {
+			return 0, err
+		}
+		listMeta, items = list.ListMeta, len(list.Items)
+	}
+
+	total := int64(items)
+	if listMeta.RemainingItemCount != nil {
+		total += *listMeta.RemainingItemCount
+	}
+	return total, nil
+}
+
+// updateSelectorStats samples, per watched namespace, how many of the events stored by the API server are excluded by
+// the selectors. Namespaces whose events cannot be counted are skipped until the next sample.
+func (e *EventWatcher) updateSelectorStats() {
+	e.mu.Lock()
+	stores := make(map[string]int, len(e.informers))
+	for namespace, i := range e.informers {
+		stores[namespace] = len(i.informer.GetStore().ListKeys())
+	}
+	previous := e.selectorStatsNamespaces
+	e.mu.Unlock()
+
+	gauge := e.metricsStore.EventsExcludedBySelectors
+	sampled := make(map[string]struct{}, len(stores))
+	for namespace, selected := range stores {
+		delete(previous, namespace)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		total, err := e.countEvents(ctx, namespace)
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Str("namespace", namespace).Msg("Cannot count events for selector stats, skipping namespace")
+			gauge.DeleteLabelValues(e.clusterName, namespace)
+			continue
+		}
+
+		excluded := total - int64(selected)
+		if excluded < 0 {
+			excluded = 0
+		}
+		gauge.WithLabelValues(e.clusterName, namespace).Set(float64(excluded))
+		sampled[namespace] = struct{}{}
+	}
+
+	// Namespaces that are no longer watched have no excluded events to report
+	for namespace := range previous {
+		gauge.DeleteLabelValues(e.clusterName, namespace)
+	}
+
+	e.mu.Lock()
+	e.selectorStatsNamespaces = sampled
+	e.mu.Unlock()
+}
+
+func (e *EventWatcher) runSelectorStats() {
+	ticker := time.NewTicker(selectorStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.updateSelectorStats()
+		case <-e.stopper:
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestEventSelectorConfig_BuildFieldSelector(t *testing.T) {
+	cfg := EventSelectorConfig{
+		Type:               "Warning",
+		InvolvedObjectKind: "Pod",
+		Source:             "kubelet",
+		FieldSelector:      "reason!=Pulled",
+	}
+
+	selector, err := cfg.BuildFieldSelector(EventsAPICoreV1)
+	require.NoError(t, err)
+	require.Equal(t, "type=Warning,involvedObject.kind=Pod,source=kubelet,reason!=Pulled", selector)
+
+	selector, err = cfg.BuildFieldSelector(EventsAPIEventsV1)
+	require.NoError(t, err)
+	require.Equal(t, "type=Warning,regarding.kind=Pod,reportingController=kubelet,reason!=Pulled", selector)
+}
+
+func TestEventSelectorConfig_Empty(t *testing.T) {
+	cfg := EventSelectorConfig{}
+	require.True(t, cfg.IsEmpty())
+
+	selector, err := cfg.BuildFieldSelector(EventsAPICoreV1)
+	require.NoError(t, err)
+	require.Equal(t, "", selector)
+}
+
+func TestEventSelectorConfig_Invalid(t *testing.T) {
+	cfg := EventSelectorConfig{FieldSelector: "type"}
+
+	_, err := cfg.BuildFieldSelector(EventsAPICoreV1)
+	require.Error(t, err)
+}
+
+func TestUpdateSelectorStats(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	event := func(namespace, name string) *corev1.Event {
+		return &corev1.Event{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	clientset := fake.NewSimpleClientset(event("shop", "a"), event("shop", "b"), event("shop", "c"), event("orders", "a"))
+	clientset.PrependReactor("list", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "broken" {
+			return true, nil, errors.New("forbidden")
+		}
+		return false, nil, nil
+	})
+
+	informer := func(events ...*corev1.Event) *eventInformer {
+		i := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Event{}, 0, cache.Indexers{})
+		for _, ev := range events {
+			require.NoError(t, i.GetStore().Add(ev))
+		}
+		return &eventInformer{informer: i}
+	}
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.clientset = clientset
+	ew.clusterName = "prod"
+	ew.informers = map[string]*eventInformer{
+		"shop":   informer(event("shop", "a")),
+		"orders": informer(event("orders", "a")),
+		"broken": informer(),
+	}
+
+	gauge := metricsStore.EventsExcludedBySelectors
+	ew.updateSelectorStats()
+	require.Equal(t, 2, testutil.CollectAndCount(gauge))
+	require.Equal(t, float64(2), testutil.ToFloat64(gauge.WithLabelValues("prod", "shop")))
+	require.Equal(t, float64(0), testutil.ToFloat64(gauge.WithLabelValues("prod", "orders")))
+
+	// Namespaces that are no longer watched are removed
+	delete(ew.informers, "orders")
+	ew.updateSelectorStats()
+	require.Equal(t, 1, testutil.CollectAndCount(gauge))
+}
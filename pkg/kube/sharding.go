@@ -0,0 +1,472 @@
+package kube
+
+import (
+	"context"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	ShardKeyNamespace = "namespace"
+	ShardKeyUID       = "uid"
+
+	defaultShardingName        = "kubernetes-event-exporter"
+	defaultShardLeaseDuration  = 15 * time.Second
+	defaultShardRenewInterval  = 5 * time.Second
+	shardGroupLabel            = "kubernetes-event-exporter/shard-group"
+	shardVirtualNodesPerMember = 100
+)
+
+// ShardingConfig splits the events between all replicas. Every replica holds a Lease, the live Leases make up a
+// consistent hash ring and every replica exports the events whose key falls into its part of the ring.
+type ShardingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Name is the prefix of the Leases and tells replicas of different exporters apart, defaults to
+	// kubernetes-event-exporter
+	Name string `yaml:"name"`
+	// Namespace of the Leases, defaults to the namespace the exporter runs in. Required when running out of cluster.
+	Namespace string `yaml:"namespace"`
+	// Key the events are distributed by, namespace (default) or uid of the involved object
+	Key                  string `yaml:"key"`
+	LeaseDurationSeconds int64  `yaml:"leaseDurationSeconds"`
+	RenewIntervalSeconds int64  `yaml:"renewIntervalSeconds"`
+}
+
+func (c ShardingConfig) GetLeaseDuration() time.Duration {
+	return secondsOrDefault(c.LeaseDurationSeconds, defaultShardLeaseDuration)
+}
+
+func (c ShardingConfig) GetRenewInterval() time.Duration {
+	return secondsOrDefault(c.RenewIntervalSeconds, defaultShardRenewInterval)
+}
+
+// hashRing maps keys to members, adding or removing a member only moves the keys of that member
+type hashRing struct {
+	points  []uint64
+	members map[uint64]string
+}
+
+func newHashRing(members []string) *hashRing {
+	r := &hashRing{members: make(map[uint64]string, len(members)*shardVirtualNodesPerMember)}
+	for _, member := range members {
+		for i := 0; i < shardVirtualNodesPerMember; i++ {
+			point := hashKey(member + "#" + strconv.Itoa(i))
+			r.points = append(r.points, point)
+			r.members[point] = member
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+func (r *hashRing) owner(key string) string {
+	if r == nil || len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
+
+// hashKey spreads the keys over the ring. FNV alone keeps keys that differ in a few bytes close to each other, like
+// the virtual nodes of a member, so its sum is mixed with the finalizer of SplitMix64.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// shardMember is a replica as observed through its Lease. Liveness is judged by the local time the renewal was
+// observed, so that the clocks of the replicas do not need to agree.
+type shardMember struct {
+	renewTime  metav1.MicroTime
+	observedAt time.Time
+	duration   time.Duration
+}
+
+// rebalanceFunc is called when this replica gains keys, because other replicas left or handed over the keys this
+// replica took over when it joined. Events with gained keys that occurred after since may not have been exported by
+// their previous owner.
+type rebalanceFunc func(gained func(event *corev1.Event) bool, since time.Time)
+
+// ShardMembership maintains the Lease of this replica and the hash ring of all live replicas
+type ShardMembership struct {
+	identity      string
+	leaseName     string
+	namespace     string
+	group         string
+	key           string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	clientset     kubernetes.Interface
+	metricsStore  *metrics.Store
+	now           func() time.Time
+
+	mu        sync.RWMutex
+	ring      *hashRing
+	members   map[string]*shardMember
+	live      map[string]struct{}
+	listeners []rebalanceFunc
+	// joinRing is the ring of the replicas that were running when this replica joined. The keys this replica took
+	// over from one of them stay with it until it renewed its Lease once more, as only then it has seen this replica.
+	joinRing *hashRing
+	pending  map[string]struct{}
+}
+
+func NewShardMembership(cfg ShardingConfig, config *rest.Config, metricsStore *metrics.Store) (*ShardMembership, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newShardMembership(cfg, clientset, hostname, metricsStore), nil
+}
+
+func newShardMembership(cfg ShardingConfig, clientset kubernetes.Interface, hostname string, metricsStore *metrics.Store) *ShardMembership {
+	group := cfg.Name
+	if group == "" {
+		group = defaultShardingName
+	}
+
+	namespace := NamespaceOrDefault(cfg.Namespace)
+
+	key := cfg.Key
+	if key == "" {
+		key = ShardKeyNamespace
+	}
+
+	// Host names may not be valid object names, the UID keeps the Lease of a restarted pod apart from its old one
+	id := string(uuid.NewUUID())
+	return &ShardMembership{
+		identity:      hostname + "_" + id,
+		leaseName:     group + "-" + id,
+		namespace:     namespace,
+		group:         group,
+		key:           key,
+		leaseDuration: cfg.GetLeaseDuration(),
+		renewInterval: cfg.GetRenewInterval(),
+		clientset:     clientset,
+		metricsStore:  metricsStore,
+		now:           time.Now,
+		members:       make(map[string]*shardMember),
+	}
+}
+
+// Join creates the Lease of this replica and builds the ring from the replicas that are already running
+func (s *ShardMembership) Join(ctx context.Context) error {
+	if err := s.renew(ctx); err != nil {
+		return err
+	}
+	if err := s.sync(ctx); err != nil {
+		return err
+	}
+	log.Info().Str("identity", s.identity).Int("members", len(s.live)).Msg("Joined shard group " + s.group)
+	return nil
+}
+
+// Run renews the Lease and follows the other replicas until the context is done. The Lease is deleted on return so
+// that the remaining replicas take over right away.
+func (s *ShardMembership) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.renew(ctx); err != nil {
+				log.Error().Err(err).Msg("Cannot renew shard lease")
+			}
+			if err := s.sync(ctx); err != nil {
+				log.Error().Err(err).Msg("Cannot list shard leases")
+			}
+		case <-ctx.Done():
+			s.leave()
+			return
+		}
+	}
+}
+
+func (s *ShardMembership) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.renewInterval)
+	defer cancel()
+
+	err := s.clientset.CoordinationV1().Leases(s.namespace).Delete(ctx, s.leaseName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error().Err(err).Msg("Cannot delete shard lease, the other replicas take over once it expires")
+		return
+	}
+	log.Info().Str("identity", s.identity).Msg("Left shard group " + s.group)
+}
+
+func (s *ShardMembership) renew(ctx context.Context) error {
+	leases := s.clientset.CoordinationV1().Leases(s.namespace)
+	now := metav1.NewMicroTime(s.now())
+	duration := int32(s.leaseDuration.Seconds())
+
+	lease, err := leases.Get(ctx, s.leaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.leaseName,
+				Namespace: s.namespace,
+				Labels:    map[string]string{shardGroupLabel: s.group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = &duration
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// sync lists the Leases of the group and rebuilds the ring if replicas joined or left
+func (s *ShardMembership) sync(ctx context.Context) error {
+	list, err := s.clientset.CoordinationV1().Leases(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: shardGroupLabel + "=" + s.group,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	handovers := make(map[string]time.Time)
+	listed := make(map[string]struct{}, len(list.Items))
+	for _, lease := range list.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+			continue
+		}
+		identity := *lease.Spec.HolderIdentity
+		listed[identity] = struct{}{}
+
+		duration := s.leaseDuration
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+
+		member, ok := s.members[identity]
+		if !ok {
+			// A Lease seen for the first time counts as renewed now, an abandoned one drops out after its duration
+			s.members[identity] = &shardMember{renewTime: *lease.Spec.RenewTime, observedAt: now, duration: duration}
+			continue
+		}
+		if !member.renewTime.Equal(lease.Spec.RenewTime) {
+			if _, ok := s.pending[identity]; ok {
+				// The replica renewed after this replica joined and moves the keys on its next sync, events up to
+				// its previous renewal were exported by it
+				handovers[identity] = member.observedAt
+			}
+			member.renewTime = *lease.Spec.RenewTime
+			member.observedAt = now
+		}
+		member.duration = duration
+	}
+
+	// This replica is always part of the ring, even if its Lease could not be renewed
+	if _, ok := s.members[s.identity]; !ok {
+		s.members[s.identity] = &shardMember{duration: s.leaseDuration}
+	}
+	s.members[s.identity].observedAt = now
+
+	live := make(map[string]struct{}, len(s.members))
+	for identity, member := range s.members {
+		_, ok := listed[identity]
+		if identity == s.identity || (ok && member.observedAt.Add(member.duration).After(now)) {
+			live[identity] = struct{}{}
+		}
+	}
+
+	// Keys only move to this replica if their owner left, events since its last renewal may be missing
+	var since time.Time
+	departed := false
+	for identity := range s.live {
+		if _, ok := live[identity]; ok {
+			continue
+		}
+		if observedAt := s.members[identity].observedAt; !departed || observedAt.Before(since) {
+			since = observedAt
+		}
+		departed = true
+	}
+	for identity := range s.pending {
+		if _, ok := live[identity]; !ok {
+			handovers[identity] = s.members[identity].observedAt
+		}
+	}
+	joinRing := s.joinRing
+	for identity := range handovers {
+		delete(s.pending, identity)
+	}
+	if len(s.pending) == 0 {
+		s.joinRing = nil
+	}
+	for identity := range s.members {
+		if _, ok := listed[identity]; !ok && identity != s.identity {
+			delete(s.members, identity)
+		}
+	}
+
+	previous := s.ring
+	current := previous
+	changed := previous == nil || departed || len(live) != len(s.live)
+	names := make([]string, 0, len(live))
+	if changed {
+		others := make([]string, 0, len(live))
+		for identity := range live {
+			names = append(names, identity)
+			if identity != s.identity {
+				others = append(others, identity)
+			}
+		}
+		sort.Strings(names)
+		current = newHashRing(names)
+		s.ring = current
+		s.live = live
+		if previous == nil && len(others) > 0 {
+			// The replicas that are already running export the keys of this replica until they have seen it
+			sort.Strings(others)
+			s.joinRing = newHashRing(others)
+			s.pending = make(map[string]struct{}, len(others))
+			for _, identity := range others {
+				s.pending[identity] = struct{}{}
+			}
+		}
+	}
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	if changed {
+		s.metricsStore.ShardMembers.Set(float64(len(names)))
+	}
+	if changed && previous != nil {
+		s.metricsStore.ShardRebalances.Inc()
+		log.Info().Strs("members", names).Msg("Shard members changed, rebalancing")
+	}
+
+	if changed && previous != nil && departed {
+		gained := func(event *corev1.Event) bool {
+			key := s.eventKey(event)
+			return current.owner(key) == s.identity && previous.owner(key) != s.identity
+		}
+		for _, listener := range listeners {
+			listener(gained, since)
+		}
+	}
+
+	for identity, since := range handovers {
+		identity := identity
+		log.Info().Str("previousOwner", identity).Msg("Shard keys handed over to this replica")
+		gained := func(event *corev1.Event) bool {
+			key := s.eventKey(event)
+			return current.owner(key) == s.identity && joinRing.owner(key) == identity
+		}
+		for _, listener := range listeners {
+			listener(gained, since)
+		}
+	}
+	return nil
+}
+
+// onRebalance registers a function that is called when this replica takes over keys from other replicas
+func (s *ShardMembership) onRebalance(fn rebalanceFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// owns returns true if this replica exports the event
+func (s *ShardMembership) owns(event *corev1.Event) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key := s.eventKey(event)
+	if s.ring.owner(key) != s.identity {
+		return false
+	}
+	if s.joinRing != nil {
+		if _, ok := s.pending[s.joinRing.owner(key)]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ShardMembership) eventKey(event *corev1.Event) string {
+	if s.key == ShardKeyUID {
+		// Events about objects without UID, e.g. from some controllers, are spread by their own UID
+		if event.InvolvedObject.UID != "" {
+			return string(event.InvolvedObject.UID)
+		}
+		return string(event.UID)
+	}
+	return event.Namespace
+}
+
+// ownsEvent returns true if the event is exported by this replica
+func (e *EventWatcher) ownsEvent(event *corev1.Event) bool {
+	return e.shards == nil || e.shards.owns(event)
+}
+
+// onRebalance exports the cached events this replica took over that their previous owner may have missed
+func (e *EventWatcher) onRebalance(gained func(event *corev1.Event) bool, since time.Time) {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return
+	}
+	// Stop waits for the replay, so no event is enqueued once the enrichment workers are gone
+	e.wg.Add(1)
+	defer e.wg.Done()
+	stores := make([]cache.Store, 0, len(e.informers))
+	for _, i := range e.informers {
+		stores = append(stores, i.informer.GetStore())
+	}
+	e.mu.Unlock()
+
+	for _, store := range stores {
+		for _, obj := range store.List() {
+			event, ok := toCoreEvent(obj)
+			if !ok || !e.namespaces.isWatched(event.Namespace) || !gained(event) || !eventTimestamp(event).After(since) {
+				continue
+			}
+			e.onEvent(event)
+		}
+	}
+}
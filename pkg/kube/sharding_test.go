@@ -0,0 +1,229 @@
+package kube
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHashRing(t *testing.T) {
+	before := newHashRing([]string{"a", "b", "c"})
+	after := newHashRing([]string{"a", "c"})
+
+	owned := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := "namespace-" + strconv.Itoa(i)
+		owner := before.owner(key)
+		owned[owner]++
+
+		// Only the keys of the removed member move
+		if owner != "b" {
+			require.Equal(t, owner, after.owner(key))
+		} else {
+			require.NotEqual(t, "b", after.owner(key))
+		}
+	}
+	for _, member := range []string{"a", "b", "c"} {
+		require.Greater(t, owned[member], 250, member)
+	}
+
+	require.Equal(t, "", (*hashRing)(nil).owner("default"))
+}
+
+func newShardTestEvent(namespace string, timestamp time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: namespace, Name: "event", UID: types.UID(namespace)},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: "pod"},
+		LastTimestamp:  metav1.Time{Time: timestamp},
+		Count:          1,
+	}
+}
+
+func TestShardMembership(t *testing.T) {
+	storeA := metrics.NewMetricsStore("a_")
+	defer metrics.DestroyMetricsStore(storeA)
+	storeB := metrics.NewMetricsStore("b_")
+	defer metrics.DestroyMetricsStore(storeB)
+
+	clientset := fake.NewSimpleClientset()
+	cfg := ShardingConfig{Namespace: "monitoring"}
+	a := newShardMembership(cfg, clientset, "a", storeA)
+	b := newShardMembership(cfg, clientset, "b", storeB)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, a.Join(context.Background()))
+	require.NoError(t, b.Join(context.Background()))
+	require.NoError(t, a.sync(context.Background()))
+	require.Equal(t, float64(2), testutil.ToFloat64(storeA.ShardMembers))
+	require.Equal(t, float64(1), testutil.ToFloat64(storeA.ShardRebalances))
+
+	// The joining replica takes over its keys once the running one renewed, it has seen the joining replica by then
+	for i := 0; i < 100; i++ {
+		require.False(t, b.owns(newShardTestEvent("namespace-"+strconv.Itoa(i), now)))
+	}
+	now = now.Add(time.Second)
+	require.NoError(t, a.renew(context.Background()))
+	require.NoError(t, b.sync(context.Background()))
+
+	// Every event is exported by exactly one replica
+	ownedByB := make([]*corev1.Event, 0)
+	for i := 0; i < 100; i++ {
+		event := newShardTestEvent("namespace-"+strconv.Itoa(i), now)
+		require.NotEqual(t, a.owns(event), b.owns(event))
+		if b.owns(event) {
+			ownedByB = append(ownedByB, event)
+		}
+	}
+	require.NotEmpty(t, ownedByB)
+
+	var since time.Time
+	gained := 0
+	a.onRebalance(func(isGained func(event *corev1.Event) bool, s time.Time) {
+		since = s
+		for i := 0; i < 100; i++ {
+			if isGained(newShardTestEvent("namespace-"+strconv.Itoa(i), now)) {
+				gained++
+			}
+		}
+	})
+
+	// A replica that stops renewing drops out once its lease expires
+	now = now.Add(10 * time.Second)
+	require.NoError(t, a.renew(context.Background()))
+	require.NoError(t, a.sync(context.Background()))
+	require.Equal(t, float64(2), testutil.ToFloat64(storeA.ShardMembers))
+
+	now = now.Add(10 * time.Second)
+	require.NoError(t, a.renew(context.Background()))
+	require.NoError(t, a.sync(context.Background()))
+	require.Equal(t, float64(1), testutil.ToFloat64(storeA.ShardMembers))
+	require.Equal(t, float64(2), testutil.ToFloat64(storeA.ShardRebalances))
+	require.Equal(t, len(ownedByB), gained)
+	require.Equal(t, now.Add(-21*time.Second), since)
+	for _, event := range ownedByB {
+		require.True(t, a.owns(event))
+	}
+
+	// A replica that leaves deletes its lease
+	b.leave()
+	leases, err := clientset.CoordinationV1().Leases("monitoring").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, leases.Items, 1)
+	require.Equal(t, a.identity, *leases.Items[0].Spec.HolderIdentity)
+}
+
+func TestEventWatcher_OnRebalance(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	now := time.Now()
+	clientset := fake.NewSimpleClientset()
+	a := newShardMembership(ShardingConfig{Namespace: "monitoring", Key: ShardKeyUID}, clientset, "a", metricsStore)
+	b := newShardMembership(ShardingConfig{Namespace: "monitoring", Key: ShardKeyUID}, clientset, "b", metrics.NewMetricsStore("b_"))
+	defer metrics.DestroyMetricsStore(b.metricsStore)
+	require.NoError(t, a.Join(context.Background()))
+	require.NoError(t, b.Join(context.Background()))
+	require.NoError(t, a.sync(context.Background()))
+
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.shards = a
+	a.onRebalance(ew.onRebalance)
+	informer := informers.NewSharedInformerFactory(clientset, 0).Core().V1().Events().Informer()
+	ew.informers = map[string]*eventInformer{"": {informer: informer}}
+
+	exported := make([]types.UID, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		exported = append(exported, e.UID)
+	}
+
+	var missed, beforeLeave, ownedByA *corev1.Event
+	for i := 0; missed == nil || beforeLeave == nil || ownedByA == nil; i++ {
+		event := newShardTestEvent("namespace-"+strconv.Itoa(i), now.Add(time.Minute))
+		switch {
+		case a.owns(event) && ownedByA == nil:
+			ownedByA = event
+		case a.owns(event):
+			continue
+		case missed == nil:
+			missed = event
+		case beforeLeave == nil:
+			event.LastTimestamp = metav1.Time{Time: now.Add(-time.Minute)}
+			beforeLeave = event
+		default:
+			continue
+		}
+		// Events of other replicas are not exported
+		ew.OnAdd(event)
+		require.NoError(t, informer.GetStore().Add(event))
+	}
+	require.Equal(t, []types.UID{ownedByA.UID}, exported)
+
+	exported = exported[:0]
+	b.leave()
+	require.NoError(t, a.sync(context.Background()))
+	require.Equal(t, []types.UID{missed.UID}, exported)
+}
+
+func TestEventWatcher_OnRebalance_Join(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	now := time.Now()
+	clientset := fake.NewSimpleClientset()
+	a := newShardMembership(ShardingConfig{Namespace: "monitoring", Key: ShardKeyUID}, clientset, "a", metrics.NewMetricsStore("a_"))
+	defer metrics.DestroyMetricsStore(a.metricsStore)
+	b := newShardMembership(ShardingConfig{Namespace: "monitoring", Key: ShardKeyUID}, clientset, "b", metricsStore)
+	a.now = func() time.Time { return now }
+	b.now = func() time.Time { return now }
+	require.NoError(t, a.Join(context.Background()))
+	require.NoError(t, b.Join(context.Background()))
+
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.shards = b
+	b.onRebalance(ew.onRebalance)
+	informer := informers.NewSharedInformerFactory(clientset, 0).Core().V1().Events().Informer()
+	ew.informers = map[string]*eventInformer{"": {informer: informer}}
+
+	exported := make([]types.UID, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		exported = append(exported, e.UID)
+	}
+
+	// The initial list of the joining replica holds events the running replica already exported
+	var exportedByA, missed *corev1.Event
+	for i := 0; exportedByA == nil || missed == nil; i++ {
+		event := newShardTestEvent("namespace-"+strconv.Itoa(i), now.Add(-time.Minute))
+		key := b.eventKey(event)
+		if b.ring.owner(key) != b.identity {
+			continue
+		}
+		if exportedByA == nil {
+			exportedByA = event
+		} else {
+			event.LastTimestamp = metav1.Time{Time: now.Add(time.Second)}
+			missed = event
+		}
+		ew.OnAdd(event)
+		require.NoError(t, informer.GetStore().Add(event))
+	}
+	require.Empty(t, exported)
+
+	// Once the running replica renewed it stopped exporting the keys, later events are replayed
+	now = now.Add(5 * time.Second)
+	require.NoError(t, a.renew(context.Background()))
+	require.NoError(t, b.sync(context.Background()))
+	require.Equal(t, []types.UID{missed.UID}, exported)
+	require.True(t, b.owns(exportedByA))
+}
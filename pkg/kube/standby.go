@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// standbyHandler receives the events of a standby watcher. Nothing is exported, the events only keep the metadata
+// cache warm for the moment the replica becomes the leader.
+type standbyHandler struct {
+	watcher *EventWatcher
+}
+
+func (h standbyHandler) OnAdd(obj interface{}) {
+	e := h.watcher
+	event, ok := toCoreEvent(obj)
+	if !ok || !e.namespaces.isWatched(event.Namespace) || time.Since(eventTimestamp(event)) > e.maxEventAgeSeconds {
+		return
+	}
+	e.warm(event)
+}
+
+func (h standbyHandler) OnUpdate(_, _ interface{}) {
+	// Count updates do not change the involved object
+}
+
+func (h standbyHandler) OnDelete(_ interface{}) {
+}
+
+// warm looks up the involved object without exporting the event. Lookups are skipped if the workers are busy.
+func (e *EventWatcher) warm(event *corev1.Event) {
+	if e.enrichment == nil {
+		return
+	}
+
+	select {
+	case e.enrichment.jobs <- enrichmentJob{event: event, warm: true}:
+		e.metricsStore.EnrichmentQueueDepth.Inc()
+	default:
+	}
+}
+
+// warmMetadata fills the metadata cache with the involved object and its owners
+func (e *EventWatcher) warmMetadata(ctx context.Context, event *corev1.Event) {
+	objectMetadata, err := e.objectMetadataCache.GetObjectMetadata(ctx, &event.InvolvedObject, e.dynamicClient, e.metricsStore)
+	if err == nil && e.ownerChain.Enabled {
+		e.resolveOwnerChain(ctx, event.InvolvedObject.Namespace, objectMetadata.OwnerReferences)
+	}
+}
+
+// Promote makes a standby watcher export events. The checkpoint of the previous leader is loaded once more and the
+// cached events are replayed against it, so events the previous leader exported are skipped and events it missed
+// are exported.
+func (e *EventWatcher) Promote() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.standby || e.stopped {
+		return
+	}
+	log.Info().Str("cluster", e.clusterName).Msg("Promoting standby watcher")
+
+	if e.checkpoint != nil {
+		close(e.followStop)
+		if err := e.checkpoint.load(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Cannot load checkpoint of the previous leader")
+		}
+		e.runCheckpoint()
+	}
+
+	e.standby = false
+	e.promotedAt = time.Now()
+	for _, i := range e.informers {
+		// A new handler receives all cached events before any live one, so nothing is missed or seen twice
+		if _, err := i.informer.AddEventHandler(e); err != nil {
+			log.Error().Err(err).Msg("Cannot promote event informer")
+			continue
+		}
+		if err := i.informer.RemoveEventHandler(i.standbyHandler); err != nil {
+			log.Error().Err(err).Msg("Cannot remove standby event handler")
+		}
+	}
+}
+
+// followCheckpoint reloads the checkpoint of the leader periodically until the watcher is promoted
+func (e *EventWatcher) followCheckpoint() {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(e.checkpoint.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := e.checkpoint.reload(context.Background()); err != nil {
+					log.Debug().Err(err).Msg("Cannot load checkpoint of the leader")
+				}
+			case <-e.followStop:
+				return
+			case <-e.stopper:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package kube
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newStandbyTestWatcher returns a standby watcher whose informer has synced the events, and the UIDs it exports
+func newStandbyTestWatcher(t *testing.T, metricsStore *metrics.Store, store CheckpointStore, events ...runtime.Object) (*EventWatcher, func() []types.UID) {
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.clientset = fake.NewSimpleClientset(events...)
+	ew.informers = make(map[string]*eventInformer)
+	ew.stopper = make(chan struct{})
+	ew.standby = true
+	ew.followStop = make(chan struct{})
+	ew.checkpoint = newCheckpointTracker(CheckpointConfig{Enabled: true}, store)
+	require.NoError(t, ew.checkpoint.load(context.Background()))
+
+	var mu sync.Mutex
+	exported := make([]types.UID, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		exported = append(exported, e.UID)
+	}
+
+	ew.startInformer("")
+	require.True(t, cache.WaitForCacheSync(ew.stopper, ew.informers[""].informer.HasSynced))
+	return ew, func() []types.UID {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]types.UID(nil), exported...)
+	}
+}
+
+func newStandbyTestEvent(uid, resourceVersion string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Namespace: "default", Name: uid, UID: types.UID(uid), ResourceVersion: resourceVersion},
+		LastTimestamp: metav1.Time{Time: at},
+		Count:         1,
+	}
+}
+
+func TestEventWatcher_Promote(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	now := time.Now()
+	store := &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	ew, exported := newStandbyTestWatcher(t, metricsStore, store,
+		newStandbyTestEvent("exported", "90", now.Add(-2*time.Minute)),
+		newStandbyTestEvent("missed", "110", now.Add(-1*time.Minute)),
+	)
+	require.Empty(t, exported())
+
+	// The leader exports the first event before it goes away
+	require.NoError(t, store.Save(context.Background(), &Checkpoint{
+		ResourceVersion: "100",
+		Timestamp:       now.Add(-90 * time.Second),
+		Exported:        []ExportedEvent{{UID: "exported", Count: 1}},
+	}))
+
+	ew.Promote()
+	require.Eventually(t, func() bool {
+		return len(exported()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ew.Stop()
+	require.Equal(t, []types.UID{"missed"}, exported())
+
+	checkpoint, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "110", checkpoint.ResourceVersion)
+}
+
+func TestEventWatcher_Promote_ExportedOverflow(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	now := time.Now()
+	store := &fileCheckpointStore{path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	ew, exported := newStandbyTestWatcher(t, metricsStore, store,
+		newStandbyTestEvent("overflowed", "80", now.Add(-3*time.Minute)),
+		newStandbyTestEvent("exported", "90", now.Add(-2*time.Minute)),
+		newStandbyTestEvent("missed", "110", now.Add(-1*time.Minute)),
+	)
+
+	// The exported events of the checkpoint only hold the latest event, the first one fell out but is still young
+	require.NoError(t, store.Save(context.Background(), &Checkpoint{
+		ResourceVersion: "100",
+		Timestamp:       now.Add(-90 * time.Second),
+		Exported:        []ExportedEvent{{UID: "exported", Count: 1}},
+	}))
+
+	ew.Promote()
+	require.Eventually(t, func() bool {
+		return len(exported()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ew.Stop()
+	require.Equal(t, []types.UID{"missed"}, exported())
+	require.Equal(t, float64(2), testutil.ToFloat64(metricsStore.CheckpointDuplicatesSkipped))
+}
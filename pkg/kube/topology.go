@@ -0,0 +1,151 @@
+package kube
+
+import (
+	"context"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	namespacesResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	nodesResource      = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+)
+
+// NodeInfo describes the node an object runs on
+type NodeInfo struct {
+	Name         string `json:"name"`
+	Zone         string `json:"zone,omitempty"`
+	Region       string `json:"region,omitempty"`
+	InstanceType string `json:"instanceType,omitempty"`
+}
+
+// topologyEnricher adds the metadata of the namespace and the node of the involved object. Namespaces and nodes are
+// served from metadata informers, the nodes of pods are cached by pod UID as they never change.
+type topologyEnricher struct {
+	namespaces cache.SharedIndexInformer
+	nodes      cache.SharedIndexInformer
+	podNodes   *lru.Cache
+	clientset  kubernetes.Interface
+}
+
+func newTopologyEnricher(cfg EnrichmentConfig, client metadata.Interface, clientset kubernetes.Interface, cacheSize int) *topologyEnricher {
+	t := &topologyEnricher{clientset: clientset}
+	if cfg.Namespace {
+		t.namespaces = metadatainformer.NewFilteredMetadataInformer(client, namespacesResource, "", 0, cache.Indexers{}, nil).Informer()
+	}
+	if cfg.Node {
+		t.nodes = metadatainformer.NewFilteredMetadataInformer(client, nodesResource, "", 0, cache.Indexers{}, nil).Informer()
+		podNodes, err := lru.New(cacheSize)
+		if err != nil {
+			panic("cannot init cache: " + err.Error())
+		}
+		t.podNodes = podNodes
+	}
+	return t
+}
+
+func (t *topologyEnricher) informers() []cache.SharedIndexInformer {
+	informers := make([]cache.SharedIndexInformer, 0, 2)
+	for _, informer := range []cache.SharedIndexInformer{t.namespaces, t.nodes} {
+		if informer != nil {
+			informers = append(informers, informer)
+		}
+	}
+	return informers
+}
+
+func (t *topologyEnricher) enrich(ctx context.Context, ev *EnhancedEvent, metricsStore *metrics.Store) {
+	if t.namespaces != nil && ev.Namespace != "" {
+		if namespace := getMetadata(t.namespaces, ev.Namespace); namespace != nil {
+			ev.NamespaceLabels = namespace.Labels
+			ev.NamespaceAnnotations = namespace.Annotations
+		}
+	}
+
+	if t.nodes == nil {
+		return
+	}
+
+	var nodeName string
+	switch ev.InvolvedObject.Kind {
+	case "Pod":
+		nodeName = t.podNodeName(ctx, ev, metricsStore)
+	case "Node":
+		nodeName = ev.InvolvedObject.Name
+	}
+	if nodeName == "" {
+		return
+	}
+
+	ev.Node = &NodeInfo{Name: nodeName}
+	if node := getMetadata(t.nodes, nodeName); node != nil {
+		ev.Node.Zone = node.Labels[corev1.LabelTopologyZone]
+		ev.Node.Region = node.Labels[corev1.LabelTopologyRegion]
+		ev.Node.InstanceType = node.Labels[corev1.LabelInstanceTypeStable]
+	}
+}
+
+// podNodeName returns the node the pod is scheduled to, or an empty string if it is not scheduled yet
+func (t *topologyEnricher) podNodeName(ctx context.Context, ev *EnhancedEvent, metricsStore *metrics.Store) string {
+	// Events reported by the kubelet carry the node already
+	if ev.Source.Host != "" {
+		return ev.Source.Host
+	}
+
+	if val, ok := t.podNodes.Get(ev.InvolvedObject.UID); ok {
+		metricsStore.KubeApiReadCacheHits.Inc()
+		return val.(string)
+	}
+
+	pod, err := t.clientset.CoreV1().Pods(ev.InvolvedObject.Namespace).Get(ctx, ev.InvolvedObject.Name, metav1.GetOptions{})
+	metricsStore.KubeApiReadRequests.Inc()
+	if err != nil {
+		log.Debug().Err(err).Str("pod", ev.InvolvedObject.Name).Msg("Cannot get the node of the pod")
+		return ""
+	}
+
+	// Unscheduled pods are looked up again, they might be scheduled by the next event
+	if pod.Spec.NodeName != "" && pod.UID == ev.InvolvedObject.UID {
+		t.podNodes.Add(pod.UID, pod.Spec.NodeName)
+	}
+	return pod.Spec.NodeName
+}
+
+func getMetadata(informer cache.SharedIndexInformer, key string) *metav1.PartialObjectMetadata {
+	obj, exists, err := informer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return nil
+	}
+	item, _ := obj.(*metav1.PartialObjectMetadata)
+	return item
+}
+
+// startTopologyInformers runs the informers of the namespaces and nodes and waits for them to sync, so that no event
+// is enriched from an empty store
+func (e *EventWatcher) startTopologyInformers() {
+	synced := make([]cache.InformerSynced, 0, 2)
+	for _, informer := range e.topology.informers() {
+		informer := informer
+		informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			e.metricsStore.WatchErrors.Inc()
+		})
+
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			informer.Run(e.stopper)
+		}()
+		synced = append(synced, informer.HasSynced)
+	}
+
+	cache.WaitForNamedCacheSync("topology", e.stopper, synced...)
+}
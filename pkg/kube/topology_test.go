@@ -0,0 +1,101 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	fakemetadata "k8s.io/client-go/metadata/fake"
+)
+
+func TestTopologyEnricher(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", UID: "web-1"},
+		Spec:       corev1.PodSpec{NodeName: "node-2"},
+	})
+	topology := newTopologyEnricher(EnrichmentConfig{Namespace: true, Node: true},
+		fakemetadata.NewSimpleMetadataClient(fakemetadata.NewTestScheme()), clientset, 16)
+
+	require.NoError(t, topology.namespaces.GetStore().Add(&metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "default",
+			Labels:      map[string]string{"team": "payments"},
+			Annotations: map[string]string{"cost-center": "42"},
+		},
+	}))
+	for _, name := range []string{"node-1", "node-2"} {
+		require.NoError(t, topology.nodes.GetStore().Add(&metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					corev1.LabelTopologyZone:       "eu-west-1a",
+					corev1.LabelTopologyRegion:     "eu-west-1",
+					corev1.LabelInstanceTypeStable: "m5.large",
+				},
+			},
+		}))
+	}
+
+	// Kubelet events carry the node
+	ev := &EnhancedEvent{}
+	ev.Namespace = "default"
+	ev.Source.Host = "node-1"
+	ev.InvolvedObject.Kind = "Pod"
+	topology.enrich(context.Background(), ev, metricsStore)
+	require.Equal(t, map[string]string{"team": "payments"}, ev.NamespaceLabels)
+	require.Equal(t, map[string]string{"cost-center": "42"}, ev.NamespaceAnnotations)
+	require.Equal(t, &NodeInfo{Name: "node-1", Zone: "eu-west-1a", Region: "eu-west-1", InstanceType: "m5.large"}, ev.Node)
+	require.Empty(t, clientset.Actions())
+
+	// Other pod events need the pod, which is only fetched once
+	for i := 0; i < 2; i++ {
+		ev = &EnhancedEvent{}
+		ev.Namespace = "default"
+		ev.InvolvedObject.ObjectReference = corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1", UID: "web-1"}
+		topology.enrich(context.Background(), ev, metricsStore)
+		require.Equal(t, "node-2", ev.Node.Name)
+		require.Equal(t, "eu-west-1a", ev.Node.Zone)
+	}
+	require.Len(t, clientset.Actions(), 1)
+
+	// Other kinds have no node
+	ev = &EnhancedEvent{}
+	ev.InvolvedObject.Kind = "Service"
+	topology.enrich(context.Background(), ev, metricsStore)
+	require.Nil(t, ev.Node)
+}
+
+func TestEventWatcher_StartTopologyInformers(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+
+	scheme := fakemetadata.NewTestScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	client := fakemetadata.NewSimpleMetadataClient(scheme, &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "payments"}},
+	})
+
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.informers = make(map[string]*eventInformer)
+	ew.stopper = make(chan struct{})
+	ew.topology = newTopologyEnricher(EnrichmentConfig{Namespace: true}, client, fake.NewSimpleClientset(), 16)
+	require.EqualError(t, ew.checkReady(), "topology not synced")
+
+	// The first events are enriched from the synced store
+	ew.startTopologyInformers()
+	defer ew.Stop()
+	require.NoError(t, ew.checkReady())
+
+	ev := &EnhancedEvent{}
+	ev.Namespace = "default"
+	ew.topology.enrich(context.Background(), ev, metricsStore)
+	require.Equal(t, map[string]string{"team": "payments"}, ev.NamespaceLabels)
+}
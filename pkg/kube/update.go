@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// UpdateModeIgnore drops every update of an existing event, only the first occurrence is exported
+	UpdateModeIgnore = "ignore"
+	// UpdateModeExport exports an event again whenever its count is bumped by Kubernetes
+	UpdateModeExport = "export"
+
+	// OccurrenceNew is set on events that are exported for the first time
+	OccurrenceNew = "new"
+	// OccurrenceRepeat is set on events that are exported because the count of an existing event increased
+	OccurrenceRepeat = "repeat"
+
+	defaultUpdateCacheSize = 4096
+)
+
+// UpdateConfig controls how updates of existing events (i.e. Count and LastTimestamp bumps) are handled
+type UpdateConfig struct {
+	// Mode is either "ignore" (default) or "export"
+	Mode string `yaml:"mode"`
+	// MinIntervalSeconds is the minimum time between two exported updates of the same event. Updates within
+	// the interval are suppressed, the next exported update carries the accumulated CountDelta.
+	MinIntervalSeconds int64 `yaml:"minIntervalSeconds"`
+	// CacheSize is the number of events whose last exported count is remembered
+	CacheSize int `yaml:"cacheSize"`
+}
+
+// Enabled returns whether updates should be exported at all
+func (c UpdateConfig) Enabled() bool {
+	return c.Mode == UpdateModeExport
+}
+
+type exportedCount struct {
+	count int32
+	at    time.Time
+}
+
+// updateTracker remembers the last exported count of each event to compute deltas and to suppress updates that
+// arrive faster than the configured interval.
+type updateTracker struct {
+	mu          sync.Mutex
+	cache       *lru.Cache
+	minInterval time.Duration
+	now         func() time.Time
+}
+
+func newUpdateTracker(cfg UpdateConfig) *updateTracker {
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = defaultUpdateCacheSize
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		panic("cannot init cache: " + err.Error())
+	}
+
+	return &updateTracker{
+		cache:       cache,
+		minInterval: time.Second * time.Duration(cfg.MinIntervalSeconds),
+		now:         time.Now,
+	}
+}
+
+// recordNew stores the count of an event that has been exported for the first time
+func (u *updateTracker) recordNew(uid types.UID, count int32) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cache.Add(uid, exportedCount{count: count, at: u.now()})
+}
+
+// shouldExport decides whether an update to the given count must be exported. It returns the previously exported
+// count when the update passes, otherwise false is returned and the update is considered suppressed.
+func (u *updateTracker) shouldExport(uid types.UID, oldCount, newCount int32) (int32, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	previous := oldCount
+	if val, ok := u.cache.Get(uid); ok {
+		last := val.(exportedCount)
+		if now.Sub(last.at) < u.minInterval {
+			return 0, false
+		}
+		previous = last.count
+	}
+
+	if newCount <= previous {
+		return 0, false
+	}
+
+	u.cache.Add(uid, exportedCount{count: newCount, at: now})
+	return previous, true
+}
+
+func (u *updateTracker) forget(uid types.UID) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cache.Remove(uid)
+}
@@ -1,82 +1,304 @@
 package kube
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/resmoio/kubernetes-event-exporter/pkg/metrics"
 	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
 var startUpTime = time.Now()
 
+// EventHandler receives the exported events. It is called concurrently by the enrichment workers, so it must be safe
+// for concurrent use, and events are not necessarily handed over in the order they occurred.
 type EventHandler func(event *EnhancedEvent)
 
+// WatcherConfig holds the settings of the EventWatcher
+type WatcherConfig struct {
+	// ClusterName is stamped onto every event if set
+	ClusterName string
+	// Namespace watches a single namespace, all namespaces are watched if empty
+	Namespace          string
+	Namespaces         NamespacesConfig
+	MaxEventAgeSeconds int64
+	OmitLookup         bool
+	CacheSize          int
+	Updates            UpdateConfig
+	Dedup              DedupConfig
+	EventsAPIVersion   string
+	Checkpoint         CheckpointConfig
+	Selectors          EventSelectorConfig
+	OwnerChain         OwnerChainConfig
+	// Standby starts the watcher without exporting events until it is promoted
+	Standby           bool
+	Discovery         DiscoveryConfig
+	MetadataInformers MetadataInformersConfig
+	Enrichment        EnrichmentConfig
+	// Shards limits the watcher to the events of this replica, all events are exported if nil
+	Shards *ShardMembership
+	// CheckpointStore overrides the store created from the Checkpoint config, e.g. to keep the checkpoints of
+	// several clusters in the cluster the exporter runs in
+	CheckpointStore CheckpointStore
+}
+
 type EventWatcher struct {
 	wg                  sync.WaitGroup
-	informer            cache.SharedInformer
+	mu                  sync.Mutex
+	informers           map[string]*eventInformer
+	namespaceInformer   cache.SharedIndexInformer
+	namespaces          *namespaceFilter
+	perNamespace        bool
 	stopper             chan struct{}
+	stopped             bool
+	standby             bool
+	promotedAt          time.Time
+	followStop          chan struct{}
 	objectMetadataCache ObjectMetadataProvider
+	restMapper          *CachedRESTMapper
+	discovery           DiscoveryConfig
+	metadataInformers   *informerMetadataProvider
+	metadataClient      metadata.Interface
+	metadataKinds       []string
+	enrichment          *enrichmentPool
+	topology            *topologyEnricher
+	logTailer           *logTailer
 	omitLookup          bool
 	fn                  EventHandler
 	maxEventAgeSeconds  time.Duration
 	metricsStore        *metrics.Store
 	dynamicClient       *dynamic.DynamicClient
-	clientset           *kubernetes.Clientset
+	clientset           kubernetes.Interface
+	updateTracker       *updateTracker
+	seen                *seenEvents
+	eventsAPI           string
+	checkpoint          *checkpointTracker
+	fieldSelector       string
+	labelSelector       string
+	// selectorStatsNamespaces are the namespaces with a sample of the events excluded by the selectors
+	selectorStatsNamespaces map[string]struct{}
+	clusterName             string
+	ownerChain              OwnerChainConfig
+	shards                  *ShardMembership
+}
+
+// eventInformer is an informer for the events of a single namespace or of all namespaces
+type eventInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+	// standbyHandler is registered until the watcher is promoted
+	standbyHandler cache.ResourceEventHandlerRegistration
+
+	mu                sync.Mutex
+	watchError        error
+	watchErrorAt      time.Time
+	watchErrorVersion string
 }
 
-func NewEventWatcher(config *rest.Config, namespace string, MaxEventAgeSeconds int64, metricsStore *metrics.Store, fn EventHandler, omitLookup bool, cacheSize int) *EventWatcher {
+func NewEventWatcher(config *rest.Config, cfg WatcherConfig, metricsStore *metrics.Store, fn EventHandler) *EventWatcher {
 	clientset := kubernetes.NewForConfigOrDie(config)
-	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
-	informer := factory.Core().V1().Events().Informer()
+	restMapper := NewCachedRESTMapper(clientset.Discovery(), metricsStore)
 
 	watcher := &EventWatcher{
-		informer:            informer,
+		informers:           make(map[string]*eventInformer),
 		stopper:             make(chan struct{}),
-		objectMetadataCache: NewObjectMetadataProvider(cacheSize),
-		omitLookup:          omitLookup,
+		objectMetadataCache: NewObjectMetadataProvider(cfg.CacheSize, restMapper, cfg.Enrichment.notFoundTTL()),
+		restMapper:          restMapper,
+		discovery:           cfg.Discovery,
+		omitLookup:          cfg.OmitLookup,
 		fn:                  fn,
-		maxEventAgeSeconds:  time.Second * time.Duration(MaxEventAgeSeconds),
+		maxEventAgeSeconds:  time.Second * time.Duration(cfg.MaxEventAgeSeconds),
 		metricsStore:        metricsStore,
 		dynamicClient:       dynamic.NewForConfigOrDie(config),
 		clientset:           clientset,
+		eventsAPI:           cfg.EventsAPIVersion,
+		labelSelector:       cfg.Selectors.LabelSelector,
+		clusterName:         cfg.ClusterName,
+		ownerChain:          cfg.OwnerChain,
+		standby:             cfg.Standby,
+		followStop:          make(chan struct{}),
 	}
 
-	informer.AddEventHandler(watcher)
-	informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
-		watcher.metricsStore.WatchErrors.Inc()
-	})
+	if !cfg.OmitLookup {
+		watcher.enrichment = newEnrichmentPool(cfg.Enrichment)
+	}
+
+	if cfg.MetadataInformers.Enabled && !cfg.OmitLookup {
+		watcher.metadataClient = metadata.NewForConfigOrDie(config)
+		watcher.metadataInformers = newInformerMetadataProvider(watcher.metadataClient, watcher.objectMetadataCache)
+		watcher.objectMetadataCache = watcher.metadataInformers
+		watcher.metadataKinds = cfg.MetadataInformers.Kinds
+	}
+
+	if (cfg.Enrichment.Namespace || cfg.Enrichment.Node) && !cfg.OmitLookup {
+		if watcher.metadataClient == nil {
+			watcher.metadataClient = metadata.NewForConfigOrDie(config)
+		}
+		watcher.topology = newTopologyEnricher(cfg.Enrichment, watcher.metadataClient, clientset, cfg.CacheSize)
+	}
+
+	if cfg.Enrichment.Logs.Enabled && !cfg.OmitLookup {
+		watcher.logTailer = newLogTailer(cfg.Enrichment.Logs, clientset)
+	}
+
+	fieldSelector, err := cfg.Selectors.BuildFieldSelector(cfg.EventsAPIVersion)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid event field selector")
+	}
+	watcher.fieldSelector = fieldSelector
+
+	// The single namespace option is the same as including one namespace
+	namespaces := cfg.Namespaces
+	if cfg.Namespace != "" {
+		namespaces.Include = []string{cfg.Namespace}
+		namespaces.PerNamespaceInformers = true
+	}
+	if !namespaces.IsEmpty() {
+		watcher.namespaces = newNamespaceFilter(namespaces)
+		watcher.perNamespace = namespaces.PerNamespaceInformers
+	}
+	if namespaces.LabelSelector != "" {
+		watcher.namespaceInformer = newNamespaceInformer(clientset, namespaces.LabelSelector)
+		watcher.namespaces.lister = listerscorev1.NewNamespaceLister(watcher.namespaceInformer.GetIndexer())
+		if watcher.perNamespace {
+			watcher.namespaceInformer.AddEventHandler(namespaceHandler{watcher: watcher})
+		}
+	}
+
+	if cfg.Shards != nil {
+		watcher.shards = cfg.Shards
+		cfg.Shards.onRebalance(watcher.onRebalance)
+	}
+
+	if cfg.Updates.Enabled() {
+		watcher.updateTracker = newUpdateTracker(cfg.Updates)
+	}
+
+	if !cfg.Dedup.Disabled {
+		watcher.seen = newSeenEvents(cfg.Dedup)
+	}
+
+	if cfg.Checkpoint.Enabled {
+		store := cfg.CheckpointStore
+		if store == nil {
+			store, err = NewCheckpointStore(cfg.Checkpoint, clientset)
+			if err != nil {
+				log.Fatal().Err(err).Msg("cannot create checkpoint store")
+			}
+		}
+		watcher.checkpoint = newCheckpointTracker(cfg.Checkpoint, store)
+	}
 
 	return watcher
 }
 
+// newEventInformer creates an informer for the events of the namespace, an empty namespace means all namespaces
+func (e *EventWatcher) newEventInformer(namespace string) cache.SharedIndexInformer {
+	factory := informers.NewSharedInformerFactoryWithOptions(e.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(e.tweakListOptions))
+
+	var informer cache.SharedIndexInformer
+	if e.eventsAPI == EventsAPIEventsV1 {
+		informer = factory.Events().V1().Events().Informer()
+	} else {
+		informer = factory.Core().V1().Events().Informer()
+	}
+	return informer
+}
+
+func (e *EventWatcher) startInformer(namespace string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.informers[namespace]; ok || e.stopped {
+		return
+	}
+
+	if namespace != "" {
+		log.Info().Str("namespace", namespace).Msg("Watching events in namespace")
+		if e.metadataInformers != nil && e.perNamespace {
+			// Lookups wait for these informers to sync
+			e.metadataInformers.startNamespace(&e.wg, namespace)
+		}
+	}
+
+	i := &eventInformer{
+		informer: e.newEventInformer(namespace),
+		stopCh:   make(chan struct{}),
+	}
+	i.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		e.metricsStore.WatchErrors.Inc()
+		i.recordWatchError(err)
+	})
+	if e.standby {
+		i.standbyHandler, _ = i.informer.AddEventHandler(standbyHandler{watcher: e})
+	} else {
+		_, _ = i.informer.AddEventHandler(e)
+	}
+	e.informers[namespace] = i
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		i.informer.Run(i.stopCh)
+	}()
+}
+
+func (e *EventWatcher) stopInformer(namespace string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if i, ok := e.informers[namespace]; ok {
+		log.Info().Str("namespace", namespace).Msg("Stopped watching events in namespace")
+		close(i.stopCh)
+		delete(e.informers, namespace)
+		if e.metadataInformers != nil && e.perNamespace {
+			e.metadataInformers.stopNamespace(namespace)
+		}
+	}
+}
+
 func (e *EventWatcher) OnAdd(obj interface{}) {
-	event := obj.(*corev1.Event)
-	e.onEvent(event)
+	if event, ok := toCoreEvent(obj); ok && e.namespaces.isWatched(event.Namespace) && e.ownsEvent(event) {
+		e.onEvent(event)
+	}
 }
 
 func (e *EventWatcher) OnUpdate(oldObj, newObj interface{}) {
-	// Ignore updates
+	// Updates are only exported when enabled in the config
+	if e.updateTracker == nil {
+		return
+	}
+
+	oldEvent, ok := toCoreEvent(oldObj)
+	if !ok {
+		return
+	}
+	newEvent, ok := toCoreEvent(newObj)
+	if !ok || !e.namespaces.isWatched(newEvent.Namespace) || !e.ownsEvent(newEvent) {
+		return
+	}
+	e.onUpdate(oldEvent, newEvent)
 }
 
 // Ignore events older than the maxEventAgeSeconds
 func (e *EventWatcher) isEventDiscarded(event *corev1.Event) bool {
-	timestamp := event.LastTimestamp.Time
-	if timestamp.IsZero() {
-		timestamp = event.EventTime.Time
-	}
+	timestamp := eventTimestamp(event)
 	eventAge := time.Since(timestamp)
 	if eventAge > e.maxEventAgeSeconds {
 		// Log discarded events if they were created after the watcher started
 		// (to suppres warnings from initial synchrnization)
-		if timestamp.After(startUpTime) {
+		if timestamp.After(startUpTime) && timestamp.After(e.promotedAt) {
 			log.Warn().
 				Str("event age", eventAge.String()).
 				Str("event namespace", event.Namespace).
@@ -90,10 +312,99 @@ func (e *EventWatcher) isEventDiscarded(event *corev1.Event) bool {
 }
 
 func (e *EventWatcher) onEvent(event *corev1.Event) {
-	if e.isEventDiscarded(event) {
+	// Relists after a failed watch deliver the events that are already exported once more
+	if e.seen != nil && e.seen.seen(event) {
+		log.Debug().
+			Str("namespace", event.Namespace).
+			Str("name", event.Name).
+			Msg("Event already exported, suppressing duplicate")
+		e.metricsStore.DuplicatesSuppressed.Inc()
+		return
+	}
+
+	missed := false
+	if e.checkpoint != nil {
+		state, previousCount := e.checkpoint.state(event)
+		switch state {
+		case resumeExported:
+			log.Debug().
+				Str("namespace", event.Namespace).
+				Str("name", event.Name).
+				Msg("Event already exported according to the checkpoint")
+			e.metricsStore.CheckpointDuplicatesSkipped.Inc()
+			return
+		case resumeCovered:
+			// The exported events of the checkpoint are bounded, older events are only known by the high-water mark.
+			// Events that are too old would not be exported anyway and are not counted as duplicates.
+			if !e.isEventDiscarded(event) {
+				log.Debug().
+					Str("namespace", event.Namespace).
+					Str("name", event.Name).
+					Msg("Event already exported according to the checkpoint")
+				e.metricsStore.CheckpointDuplicatesSkipped.Inc()
+			}
+			return
+		case resumeUpdated:
+			// The first occurrence has been exported already, only the missed update is left
+			if e.updateTracker != nil {
+				e.metricsStore.CheckpointEventsResumed.Inc()
+				e.updateTracker.recordNew(event.UID, previousCount)
+				e.exportRepeat(event, previousCount)
+			}
+			return
+		case resumeMissed:
+			// Missed events are exported regardless of their age
+			missed = true
+			e.metricsStore.CheckpointEventsResumed.Inc()
+		}
+	}
+
+	if !missed && e.isEventDiscarded(event) {
 		return
 	}
 
+	if e.updateTracker != nil {
+		e.updateTracker.recordNew(event.UID, event.Count)
+	}
+
+	e.export(event, func(ev *EnhancedEvent) {
+		ev.Occurrence = OccurrenceNew
+	})
+}
+
+func (e *EventWatcher) onUpdate(oldEvent, newEvent *corev1.Event) {
+	// Relists deliver the same object again, and only a count bump means the event occurred again
+	if oldEvent.ResourceVersion == newEvent.ResourceVersion || newEvent.Count <= oldEvent.Count {
+		return
+	}
+
+	if e.isEventDiscarded(newEvent) {
+		return
+	}
+
+	previousCount, ok := e.updateTracker.shouldExport(newEvent.UID, oldEvent.Count, newEvent.Count)
+	if !ok {
+		log.Debug().
+			Str("namespace", newEvent.Namespace).
+			Str("name", newEvent.Name).
+			Int32("count", newEvent.Count).
+			Msg("Event update suppressed")
+		e.metricsStore.UpdatesSuppressed.Inc()
+		return
+	}
+
+	e.exportRepeat(newEvent, previousCount)
+}
+
+func (e *EventWatcher) exportRepeat(event *corev1.Event, previousCount int32) {
+	e.export(event, func(ev *EnhancedEvent) {
+		ev.Occurrence = OccurrenceRepeat
+		ev.PreviousCount = previousCount
+		ev.CountDelta = event.Count - previousCount
+	})
+}
+
+func (e *EventWatcher) export(event *corev1.Event, decorate func(ev *EnhancedEvent)) {
 	log.Debug().
 		Str("msg", event.Message).
 		Str("namespace", event.Namespace).
@@ -107,46 +418,176 @@ func (e *EventWatcher) onEvent(event *corev1.Event) {
 		Event: *event.DeepCopy(),
 	}
 	ev.Event.ManagedFields = nil
+	if e.clusterName != "" {
+		// note that per code this value is not set anywhere on the kubernetes side
+		// https://github.com/kubernetes/apimachinery/blob/v0.22.4/pkg/apis/meta/v1/types.go#L276
+		ev.ClusterName = e.clusterName
+	}
 
-	if e.omitLookup {
+	job := enrichmentJob{ev: ev, event: event, decorate: decorate}
+	switch {
+	case e.omitLookup:
 		ev.InvolvedObject.ObjectReference = *event.InvolvedObject.DeepCopy()
-	} else {
-		objectMetadata, err := e.objectMetadataCache.GetObjectMetadata(&event.InvolvedObject, e.clientset, e.dynamicClient, e.metricsStore)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				ev.InvolvedObject.Deleted = true
-				log.Error().Err(err).Msg("Object not found, likely deleted")
-			} else {
-				log.Error().Err(err).Msg("Failed to get object metadata")
-			}
-			ev.InvolvedObject.ObjectReference = *event.InvolvedObject.DeepCopy()
-		} else {
-			ev.InvolvedObject.Labels = objectMetadata.Labels
-			ev.InvolvedObject.Annotations = objectMetadata.Annotations
-			ev.InvolvedObject.OwnerReferences = objectMetadata.OwnerReferences
-			ev.InvolvedObject.ObjectReference = *event.InvolvedObject.DeepCopy()
-			ev.InvolvedObject.Deleted = objectMetadata.Deleted
+	case e.enrichment != nil:
+		if e.checkpoint != nil {
+			job.checkpointID = e.checkpoint.begin(event)
 		}
+		e.enqueue(job)
+		return
+	default:
+		e.enrich(context.Background(), ev, event)
+		e.tailLogs(ev)
+	}
+	e.deliver(job)
+}
+
+// deliver hands the event to the handler once the lookup is done and records it as exported
+func (e *EventWatcher) deliver(job enrichmentJob) {
+	ev := job.ev
+	if e.eventsAPI == EventsAPIEventsV1 {
+		ev.Note = ev.Message
+		ev.Regarding = &ev.InvolvedObject.ObjectReference
 	}
 
+	job.decorate(ev)
 	e.fn(ev)
+
+	// Only exported events count as seen, so that a relist brings back the events that were dropped
+	if e.seen != nil {
+		e.seen.record(job.event)
+	}
+	if e.checkpoint != nil {
+		e.checkpoint.record(job.checkpointID, job.event)
+	}
 }
 
 func (e *EventWatcher) OnDelete(obj interface{}) {
-	// Ignore deletes
+	// Deletes are not exported, we only need to forget the event
+	if e.updateTracker == nil {
+		return
+	}
+
+	if event, ok := toCoreEvent(obj); ok {
+		e.updateTracker.forget(event.UID)
+	}
 }
 
 func (e *EventWatcher) Start() {
+	e.registerHealth()
+
+	if e.checkpoint != nil {
+		// Loading before the informer starts guarantees that the initial list is checked against the checkpoint
+		if err := e.checkpoint.load(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Cannot load checkpoint, starting from scratch")
+		}
+
+		// Standby watchers leave the checkpoint to the leader
+		e.mu.Lock()
+		if e.standby {
+			e.followCheckpoint()
+		} else {
+			e.runCheckpoint()
+		}
+		e.mu.Unlock()
+	}
+
+	if e.restMapper != nil && !e.omitLookup {
+		e.runRESTMapper()
+	}
+
+	if e.enrichment != nil {
+		e.startEnrichment()
+	}
+
+	if e.topology != nil {
+		e.startTopologyInformers()
+	}
+
+	// Lookups read the kinds of the metadata informers without locking, so they are set up before any event is
+	// received
+	if e.metadataInformers != nil {
+		e.startMetadataInformers()
+	}
+
+	if e.namespaceInformer != nil {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.namespaceInformer.Run(e.stopper)
+		}()
+
+		// Events can only be filtered once the matching namespaces are known
+		if !cache.WaitForNamedCacheSync("namespaces", e.stopper, e.namespaceInformer.HasSynced) {
+			return
+		}
+	}
+
+	switch {
+	case !e.perNamespace:
+		e.startInformer("")
+	case e.namespaceInformer == nil:
+		for namespace := range e.namespaces.include {
+			if e.namespaces.matchesLists(namespace) {
+				e.startInformer(namespace)
+			}
+		}
+	default:
+		// The namespace handler starts an informer for every matching namespace
+	}
+
+	if e.fieldSelector != "" || e.labelSelector != "" {
+		log.Info().
+			Str("fieldSelector", e.fieldSelector).
+			Str("labelSelector", e.labelSelector).
+			Msg("Filtering events on the server side")
+
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.runSelectorStats()
+		}()
+	}
+}
+
+// runCheckpoint persists the checkpoint periodically
+func (e *EventWatcher) runCheckpoint() {
 	e.wg.Add(1)
 	go func() {
 		defer e.wg.Done()
-		e.informer.Run(e.stopper)
+		e.checkpoint.run(e.stopper, func(err error) {
+			e.metricsStore.CheckpointSaveErrors.Inc()
+			log.Error().Err(err).Msg("Cannot save checkpoint")
+		})
 	}()
 }
 
 func (e *EventWatcher) Stop() {
 	close(e.stopper)
+
+	e.mu.Lock()
+	e.stopped = true
+	for namespace, i := range e.informers {
+		close(i.stopCh)
+		delete(e.informers, namespace)
+	}
+	e.mu.Unlock()
+	if e.metadataInformers != nil {
+		e.metadataInformers.stop()
+	}
+
 	e.wg.Wait()
+
+	// The informers are stopped, so the queued events are the last ones
+	if e.enrichment != nil {
+		e.stopEnrichment()
+	}
+
+	if e.checkpoint != nil {
+		if err := e.checkpoint.save(); err != nil {
+			e.metricsStore.CheckpointSaveErrors.Inc()
+			log.Error().Err(err).Msg("Cannot save checkpoint")
+		}
+	}
 }
 
 func (e *EventWatcher) setStartUpTime(time time.Time) {
@@ -2,6 +2,7 @@ package kube
 
 import (
 	"bytes"
+	"context"
 	"testing"
 	"time"
 
@@ -17,7 +18,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
 )
 
 type mockObjectMetadataProvider struct {
@@ -52,7 +52,7 @@ func newMockObjectMetadataProvider() ObjectMetadataProvider {
 	return o
 }
 
-func (o *mockObjectMetadataProvider) GetObjectMetadata(reference *corev1.ObjectReference, clientset *kubernetes.Clientset, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error) {
+func (o *mockObjectMetadataProvider) GetObjectMetadata(_ context.Context, reference *corev1.ObjectReference, dynClient dynamic.Interface, metricsStore *metrics.Store) (ObjectMetadata, error) {
 	if o.objDeleted {
 		return ObjectMetadata{}, errors.NewNotFound(schema.GroupResource{}, "")
 	}
@@ -301,3 +301,100 @@ func TestOnEvent_DeletedObjects(t *testing.T) {
 	require.Equal(t, map[string]string(nil), event.InvolvedObject.Labels)
 	require.Equal(t, []metav1.OwnerReference(nil), event.InvolvedObject.OwnerReferences)
 }
+
+func TestOnUpdate_IgnoredByDefault(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+
+	called := false
+	ew.fn = func(e *EnhancedEvent) {
+		called = true
+	}
+
+	now := time.Now()
+	oldEvent := corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Name: "event1", UID: "event1", ResourceVersion: "1"},
+		LastTimestamp: metav1.Time{Time: now},
+		Count:         1,
+	}
+	newEvent := *oldEvent.DeepCopy()
+	newEvent.ResourceVersion = "2"
+	newEvent.Count = 2
+
+	ew.OnUpdate(&oldEvent, &newEvent)
+	require.False(t, called)
+}
+
+func TestOnUpdate_ExportsCountDelta(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.updateTracker = newUpdateTracker(UpdateConfig{Mode: UpdateModeExport})
+
+	events := make([]EnhancedEvent, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		events = append(events, *e)
+	}
+
+	now := time.Now()
+	event1 := corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Name: "event1", UID: "event1", ResourceVersion: "1"},
+		LastTimestamp: metav1.Time{Time: now},
+		Count:         1,
+	}
+	ew.OnAdd(&event1)
+
+	event2 := *event1.DeepCopy()
+	event2.ResourceVersion = "2"
+	event2.Count = 3
+	ew.OnUpdate(&event1, &event2)
+
+	// Same resource version is a relist, not an update
+	ew.OnUpdate(&event2, &event2)
+
+	require.Len(t, events, 2)
+	require.Equal(t, OccurrenceNew, events[0].Occurrence)
+	require.Equal(t, OccurrenceRepeat, events[1].Occurrence)
+	require.Equal(t, int32(1), events[1].PreviousCount)
+	require.Equal(t, int32(2), events[1].CountDelta)
+}
+
+func TestOnUpdate_SuppressedWithinMinInterval(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+	ew.updateTracker = newUpdateTracker(UpdateConfig{Mode: UpdateModeExport, MinIntervalSeconds: 60})
+	clock := time.Now()
+	ew.updateTracker.now = func() time.Time { return clock }
+
+	events := make([]EnhancedEvent, 0)
+	ew.fn = func(e *EnhancedEvent) {
+		events = append(events, *e)
+	}
+
+	event1 := corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Name: "event1", UID: "event1", ResourceVersion: "1"},
+		LastTimestamp: metav1.Time{Time: time.Now()},
+		Count:         1,
+	}
+	ew.OnAdd(&event1)
+
+	event2 := *event1.DeepCopy()
+	event2.ResourceVersion = "2"
+	event2.Count = 2
+	ew.OnUpdate(&event1, &event2)
+	require.Len(t, events, 1)
+	require.Equal(t, float64(1), testutil.ToFloat64(metricsStore.UpdatesSuppressed))
+
+	// After the interval passed the delta covers the suppressed update as well
+	clock = clock.Add(61 * time.Second)
+	event3 := *event2.DeepCopy()
+	event3.ResourceVersion = "3"
+	event3.Count = 4
+	ew.OnUpdate(&event2, &event3)
+
+	require.Len(t, events, 2)
+	require.Equal(t, int32(1), events[1].PreviousCount)
+	require.Equal(t, int32(3), events[1].CountDelta)
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultStallTimeout = 5 * time.Minute
+
+// HealthConfig controls the liveness endpoint
+type HealthConfig struct {
+	// StallTimeoutSeconds is how long a component may be busy with the same piece of work, e.g. sending an event to
+	// a sink, before the exporter is reported as not alive. Defaults to 300.
+	StallTimeoutSeconds int64 `yaml:"stallTimeoutSeconds"`
+}
+
+func (c HealthConfig) GetStallTimeout() time.Duration {
+	if c.StallTimeoutSeconds <= 0 {
+		return defaultStallTimeout
+	}
+	return time.Duration(c.StallTimeoutSeconds) * time.Second
+}
+
+// ReadinessCheck returns an error if the component is not ready to export events
+type ReadinessCheck func() error
+
+// BusySince returns since when the component is busy with the work it is still processing, or the zero time if it is
+// idle. A component busy for longer than the stall timeout is considered stalled.
+type BusySince func() time.Time
+
+// StatusFunc returns the state of the component for the status endpoint, it must be serializable to JSON
+type StatusFunc func() interface{}
+
+type healthRegistry struct {
+	mu           sync.RWMutex
+	stallTimeout time.Duration
+	readiness    map[string]ReadinessCheck
+	liveness     map[string]BusySince
+	status       map[string]StatusFunc
+	now          func() time.Time
+}
+
+var health = newHealthRegistry()
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{
+		stallTimeout: defaultStallTimeout,
+		readiness:    make(map[string]ReadinessCheck),
+		liveness:     make(map[string]BusySince),
+		status:       make(map[string]StatusFunc),
+		now:          time.Now,
+	}
+}
+
+// RegisterReadinessCheck adds a check to the /-/ready endpoint, a check registered under the same name is replaced
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.readiness[name] = check
+}
+
+// RegisterLivenessCheck adds a component to the /-/healthy endpoint
+func RegisterLivenessCheck(name string, busySince BusySince) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.liveness[name] = busySince
+}
+
+// RegisterStatus adds a component to the /-/status endpoint
+func RegisterStatus(name string, status StatusFunc) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.status[name] = status
+}
+
+// UnregisterHealth removes all checks and the status of the component
+func UnregisterHealth(name string) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	delete(health.readiness, name)
+	delete(health.liveness, name)
+	delete(health.status, name)
+}
+
+func (h *healthRegistry) checkReadiness() map[string]error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := make(map[string]error, len(h.readiness))
+	for name, check := range h.readiness {
+		results[name] = check()
+	}
+	return results
+}
+
+func (h *healthRegistry) checkLiveness() map[string]error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := make(map[string]error, len(h.liveness))
+	now := h.now()
+	for name, busySince := range h.liveness {
+		since := busySince()
+		if !since.IsZero() && now.Sub(since) > h.stallTimeout {
+			results[name] = fmt.Errorf("stalled for %s", now.Sub(since).Truncate(time.Second))
+		} else {
+			results[name] = nil
+		}
+	}
+	return results
+}
+
+func (h *healthRegistry) componentStatus() map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := make(map[string]interface{}, len(h.status))
+	for name, status := range h.status {
+		results[name] = status()
+	}
+	return results
+}
+
+// checkHandler responds with 200 if all checks pass, and with 503 listing the failed checks otherwise
+func checkHandler(check func() map[string]error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures := make([]string, 0)
+		for name, err := range check() {
+			if err != nil {
+				failures = append(failures, name+": "+err.Error())
+			}
+		}
+
+		if len(failures) > 0 {
+			sort.Strings(failures)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, strings.Join(failures, "\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "OK")
+	}
+}
+
+type healthStatus struct {
+	Ready      bool                   `json:"ready"`
+	Live       bool                   `json:"live"`
+	Readiness  map[string]string      `json:"readiness"`
+	Liveness   map[string]string      `json:"liveness"`
+	Components map[string]interface{} `json:"components"`
+}
+
+func checkResults(results map[string]error) (map[string]string, bool) {
+	ok := true
+	messages := make(map[string]string, len(results))
+	for name, err := range results {
+		if err != nil {
+			ok = false
+			messages[name] = err.Error()
+		} else {
+			messages[name] = "ok"
+		}
+	}
+	return messages, ok
+}
+
+func (h *healthRegistry) statusHandler(w http.ResponseWriter, r *http.Request) {
+	status := healthStatus{Components: h.componentStatus()}
+	status.Readiness, status.Ready = checkResults(h.checkReadiness())
+	status.Liveness, status.Live = checkResults(h.checkLiveness())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Error().Err(err).Msg("Cannot write health status")
+	}
+}
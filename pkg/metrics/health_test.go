@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	now := time.Now()
+	h := newHealthRegistry()
+	h.now = func() time.Time { return now }
+	h.stallTimeout = time.Minute
+
+	var readyErr error
+	var busySince time.Time
+	h.readiness["watcher"] = func() error { return readyErr }
+	h.liveness["receivers"] = func() time.Time { return busySince }
+	h.status["receivers"] = func() interface{} { return map[string]int{"sends": 1} }
+
+	ready := checkHandler(h.checkReadiness)
+	healthy := checkHandler(h.checkLiveness)
+
+	rec := httptest.NewRecorder()
+	ready(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	readyErr = errors.New("not synced")
+	rec = httptest.NewRecorder()
+	ready(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "watcher: not synced", rec.Body.String())
+
+	// Busy, but not for longer than the stall timeout
+	busySince = now.Add(-30 * time.Second)
+	rec = httptest.NewRecorder()
+	healthy(rec, httptest.NewRequest(http.MethodGet, "/-/healthy", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	busySince = now.Add(-2 * time.Minute)
+	rec = httptest.NewRecorder()
+	healthy(rec, httptest.NewRequest(http.MethodGet, "/-/healthy", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "receivers: stalled for 2m0s", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.statusHandler(rec, httptest.NewRequest(http.MethodGet, "/-/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status healthStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.False(t, status.Ready)
+	require.False(t, status.Live)
+	require.Equal(t, map[string]string{"watcher": "not synced"}, status.Readiness)
+	require.Equal(t, map[string]interface{}{"sends": float64(1)}, status.Components["receivers"])
+}
@@ -22,6 +22,35 @@ type Store struct {
 	BuildInfo            prometheus.GaugeFunc
 	KubeApiReadCacheHits prometheus.Counter
 	KubeApiReadRequests  prometheus.Counter
+	MetadataInformerHits prometheus.Counter
+	UpdatesSuppressed    prometheus.Counter
+	DuplicatesSuppressed prometheus.Counter
+	EventsUnmatched      prometheus.Counter
+	EventsRateLimited    prometheus.Counter
+	RateLimitSummaries   prometheus.Counter
+	EventsGrouped        prometheus.Counter
+	GroupDigests         prometheus.Counter
+	EventsSilenced       prometheus.Counter
+	SilenceEvents        *prometheus.CounterVec
+
+	CheckpointEventsResumed     prometheus.Counter
+	CheckpointDuplicatesSkipped prometheus.Counter
+	CheckpointSaveErrors        prometheus.Counter
+
+	EventsExcludedBySelectors *prometheus.GaugeVec
+
+	DiscoveryRefreshes prometheus.Counter
+
+	EnrichmentQueueDepth prometheus.Gauge
+	EnrichmentLatency    prometheus.Histogram
+	EnrichmentTimeouts   prometheus.Counter
+	EnrichmentSkipped    prometheus.Counter
+
+	LogTailsFetched     prometheus.Counter
+	LogTailsRateLimited prometheus.Counter
+
+	ShardMembers    prometheus.Gauge
+	ShardRebalances prometheus.Counter
 }
 
 // promLogger implements promhttp.Logger
@@ -37,7 +66,7 @@ func (pl promLogger) Log(v ...interface{}) error {
 	return nil
 }
 
-func Init(addr string, tlsConf string) {
+func Init(addr string, tlsConf string, healthCfg HealthConfig) {
 	// Setup the prometheus metrics machinery
 	// Add Go module build info.
 	prometheus.MustRegister(collectors.NewBuildInfoCollector())
@@ -62,19 +91,22 @@ func Init(addr string, tlsConf string) {
 				Address: metricsPath,
 				Text:    "Metrics",
 			},
+			{
+				Address: "/-/status",
+				Text:    "Status",
+			},
 		},
 	}
 	landingPage, _ := web.NewLandingPage(landingConfig)
 	http.Handle("/", landingPage)
 
-	http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
-	})
-	http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
-	})
+	health.mu.Lock()
+	health.stallTimeout = healthCfg.GetStallTimeout()
+	health.mu.Unlock()
+
+	http.HandleFunc("/-/healthy", checkHandler(health.checkLiveness))
+	http.HandleFunc("/-/ready", checkHandler(health.checkReadiness))
+	http.HandleFunc("/-/status", health.statusHandler)
 
 	metricsServer := http.Server{
 		ReadHeaderTimeout: 5 * time.Second}
@@ -129,6 +161,99 @@ func NewMetricsStore(name_prefix string) *Store {
 			Name: name_prefix + "kube_api_read_cache_misses",
 			Help: "The total number of read requests served from kube-apiserver when looking up object metadata",
 		}),
+		MetadataInformerHits: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "kube_api_metadata_informer_hits",
+			Help: "The total number of object metadata lookups served from the metadata informers",
+		}),
+		UpdatesSuppressed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "event_updates_suppressed",
+			Help: "The total number of event count updates not exported because of the updates.minIntervalSeconds setting",
+		}),
+		DuplicatesSuppressed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "event_duplicates_suppressed",
+			Help: "The total number of events not exported again because they were received again after a relist",
+		}),
+		EventsUnmatched: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "events_unmatched",
+			Help: "The total number of events that matched no route, they are only exported by a default receiver",
+		}),
+		EventsRateLimited: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "events_rate_limited",
+			Help: "The total number of events not sent because they exceeded the rate limit of a route or receiver",
+		}),
+		RateLimitSummaries: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "rate_limit_summaries",
+			Help: "The total number of summaries sent for the events over a rate limit with overflow: summarize",
+		}),
+		EventsGrouped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "events_grouped",
+			Help: "The total number of events collected into groups by receivers with grouping",
+		}),
+		GroupDigests: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "group_digests",
+			Help: "The total number of digests sent for the groups of receivers with grouping",
+		}),
+		EventsSilenced: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "events_silenced",
+			Help: "The total number of events dropped by an active silence",
+		}),
+		SilenceEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "silence_events",
+			Help: "The total number of events dropped by each silence, counted for the first active silence that matches",
+		}, []string{"silence"}),
+		CheckpointEventsResumed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "checkpoint_events_resumed",
+			Help: "The total number of events exported on startup that occurred after the last checkpoint",
+		}),
+		CheckpointDuplicatesSkipped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "checkpoint_duplicates_skipped",
+			Help: "The total number of events not exported again because the checkpoint shows they were already exported",
+		}),
+		CheckpointSaveErrors: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "checkpoint_save_errors",
+			Help: "The total number of errors while persisting the checkpoint",
+		}),
+		EventsExcludedBySelectors: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name_prefix + "events_excluded_by_selectors",
+			Help: "The number of events currently stored by the API server that the configured selectors exclude from the watch, per watched namespace, sampled every 5 minutes",
+		}, []string{"cluster", "namespace"}),
+		DiscoveryRefreshes: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "discovery_refreshes",
+			Help: "The total number of times the cached API discovery used for object metadata lookups was refreshed",
+		}),
+		EnrichmentQueueDepth: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: name_prefix + "enrichment_queue_depth",
+			Help: "The number of events waiting for the metadata of their involved object to be looked up",
+		}),
+		EnrichmentLatency: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    name_prefix + "enrichment_lookup_duration_seconds",
+			Help:    "The time taken to look up the metadata of the involved object of an event, including its owner chain",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		EnrichmentTimeouts: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "enrichment_timeouts",
+			Help: "The total number of events whose involved object lookup did not finish in time",
+		}),
+		EnrichmentSkipped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "enrichment_skipped",
+			Help: "The total number of events exported without metadata because the enrichment queue was full",
+		}),
+		LogTailsFetched: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "log_tails_fetched",
+			Help: "The total number of container log tails attached to events",
+		}),
+		LogTailsRateLimited: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "log_tails_rate_limited",
+			Help: "The total number of events exported without container logs because the log budget was exhausted",
+		}),
+		ShardMembers: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: name_prefix + "shard_members",
+			Help: "The number of live replicas the events are sharded across",
+		}),
+		ShardRebalances: promauto.NewCounter(prometheus.CounterOpts{
+			Name: name_prefix + "shard_rebalances",
+			Help: "The total number of times the events were redistributed because replicas joined or left",
+		}),
 	}
 }
 
@@ -140,5 +265,28 @@ func DestroyMetricsStore(store *Store) {
 	prometheus.Unregister(store.BuildInfo)
 	prometheus.Unregister(store.KubeApiReadCacheHits)
 	prometheus.Unregister(store.KubeApiReadRequests)
+	prometheus.Unregister(store.MetadataInformerHits)
+	prometheus.Unregister(store.UpdatesSuppressed)
+	prometheus.Unregister(store.DuplicatesSuppressed)
+	prometheus.Unregister(store.EventsUnmatched)
+	prometheus.Unregister(store.EventsRateLimited)
+	prometheus.Unregister(store.RateLimitSummaries)
+	prometheus.Unregister(store.EventsGrouped)
+	prometheus.Unregister(store.GroupDigests)
+	prometheus.Unregister(store.EventsSilenced)
+	prometheus.Unregister(store.SilenceEvents)
+	prometheus.Unregister(store.CheckpointEventsResumed)
+	prometheus.Unregister(store.CheckpointDuplicatesSkipped)
+	prometheus.Unregister(store.CheckpointSaveErrors)
+	prometheus.Unregister(store.EventsExcludedBySelectors)
+	prometheus.Unregister(store.DiscoveryRefreshes)
+	prometheus.Unregister(store.EnrichmentQueueDepth)
+	prometheus.Unregister(store.EnrichmentLatency)
+	prometheus.Unregister(store.EnrichmentTimeouts)
+	prometheus.Unregister(store.EnrichmentSkipped)
+	prometheus.Unregister(store.LogTailsFetched)
+	prometheus.Unregister(store.LogTailsRateLimited)
+	prometheus.Unregister(store.ShardMembers)
+	prometheus.Unregister(store.ShardRebalances)
 	store = nil
 }
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// OverflowDrop drops the events over the limit
+	OverflowDrop = "drop"
+	// OverflowSummarize drops the events over the limit and reports them in a summary once per interval
+	OverflowSummarize = "summarize"
+
+	// DefaultKey limits the events of an object with the same reason together
+	DefaultKey = "{{ .Namespace }}/{{ .InvolvedObject.Kind }}/{{ .InvolvedObject.Name }}/{{ .Reason }}"
+
+	defaultInterval = time.Minute
+	defaultMaxKeys  = 10000
+)
+
+// Config is a token bucket for each key. Limit tokens are added per interval, up to Burst which defaults to Limit.
+type Config struct {
+	Limit           int   `yaml:"limit"`
+	IntervalSeconds int64 `yaml:"intervalSeconds"`
+	Burst           int   `yaml:"burst"`
+	// Key is a template of the event, the events with the same key share a bucket. Defaults to DefaultKey.
+	Key string `yaml:"key"`
+	// Overflow is either drop or summarize, defaults to drop
+	Overflow string `yaml:"overflow"`
+	// MaxKeys is the number of buckets kept, the least recently used one is forgotten. Defaults to 10000. The summary
+	// of a forgotten bucket is reported by the next Flush.
+	MaxKeys int `yaml:"maxKeys"`
+}
+
+func (c *Config) Validate() error {
+	if c.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if c.IntervalSeconds < 0 || c.Burst < 0 || c.MaxKeys < 0 {
+		return errors.New("intervalSeconds, burst and maxKeys cannot be negative")
+	}
+	switch c.Overflow {
+	case "", OverflowDrop, OverflowSummarize:
+	default:
+		return fmt.Errorf("overflow must be %s or %s", OverflowDrop, OverflowSummarize)
+	}
+	return nil
+}
+
+func (c *Config) GetInterval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+func (c *Config) GetKey() string {
+	if c.Key == "" {
+		return DefaultKey
+	}
+	return c.Key
+}
+
+// Summary reports the items a key dropped since the last summary
+type Summary struct {
+	Key string
+	// Last is the last item that was dropped
+	Last       interface{}
+	Suppressed int
+	Since      time.Time
+}
+
+type bucket struct {
+	limiter    *rate.Limiter
+	suppressed int
+	since      time.Time
+	last       interface{}
+}
+
+// Limiter holds the buckets of a Config. It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	buckets  *lru.Cache
+	limit    rate.Limit
+	burst    int
+	interval time.Duration
+	summary  bool
+	// evicted holds the summaries of the buckets that were forgotten while they dropped items
+	evicted []Summary
+	now     func() time.Time
+}
+
+func New(cfg Config) *Limiter {
+	size := cfg.MaxKeys
+	if size <= 0 {
+		size = defaultMaxKeys
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Limit
+	}
+
+	interval := cfg.GetInterval()
+	l := &Limiter{
+		limit:    rate.Every(interval / time.Duration(cfg.Limit)),
+		burst:    burst,
+		interval: interval,
+		summary:  cfg.Overflow == OverflowSummarize,
+		now:      time.Now,
+	}
+	// Buckets are only evicted by Allow, which holds the lock
+	buckets, err := lru.NewWithEvict(size, l.onEvict)
+	if err != nil {
+		panic("cannot init cache: " + err.Error())
+	}
+	l.buckets = buckets
+	return l
+}
+
+// onEvict keeps the summary of a forgotten bucket, so that every dropped item is reported
+func (l *Limiter) onEvict(key, value interface{}) {
+	b := value.(*bucket)
+	if b.suppressed == 0 {
+		return
+	}
+	l.evicted = append(l.evicted, Summary{Key: key.(string), Last: b.last, Suppressed: b.suppressed, Since: b.since})
+}
+
+// Summarizes returns true if the dropped items are reported by Flush
+func (l *Limiter) Summarizes() bool {
+	return l.summary
+}
+
+// Allow takes a token from the bucket of the key. If there is none, the item is remembered for the summary.
+func (l *Limiter) Allow(key string, item interface{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var b *bucket
+	if val, ok := l.buckets.Get(key); ok {
+		b = val.(*bucket)
+	} else {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets.Add(key, b)
+	}
+
+	if b.limiter.AllowN(now, 1) {
+		return true
+	}
+	if l.summary {
+		if b.suppressed == 0 {
+			b.since = now
+		}
+		b.suppressed++
+		b.last = item
+	}
+	return false
+}
+
+// Flush returns the summaries of the keys that dropped items at least an interval ago, or of all keys that dropped
+// items if force is set. The summaries of forgotten keys are always returned.
+func (l *Limiter) Flush(force bool) []Summary {
+	if !l.summary {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	summaries := l.evicted
+	l.evicted = nil
+	for _, key := range l.buckets.Keys() {
+		val, ok := l.buckets.Peek(key)
+		if !ok {
+			continue
+		}
+		b := val.(*bucket)
+		if b.suppressed == 0 || (!force && now.Sub(b.since) < l.interval) {
+			continue
+		}
+		summaries = append(summaries, Summary{Key: key.(string), Last: b.last, Suppressed: b.suppressed, Since: b.since})
+		b.suppressed = 0
+		b.last = nil
+	}
+	return summaries
+}
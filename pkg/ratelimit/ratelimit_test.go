@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := New(Config{Limit: 2, IntervalSeconds: 60})
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow("a", 1))
+	assert.True(t, l.Allow("a", 2))
+	assert.False(t, l.Allow("a", 3))
+	// Keys have their own buckets
+	assert.True(t, l.Allow("b", 1))
+
+	// A token is added every 30 seconds
+	now = now.Add(30 * time.Second)
+	assert.True(t, l.Allow("a", 4))
+	assert.False(t, l.Allow("a", 5))
+
+	// Dropped events are not summarized by default
+	assert.Empty(t, l.Flush(true))
+}
+
+func TestLimiter_Summarize(t *testing.T) {
+	now := time.Now()
+	start := now
+	l := New(Config{Limit: 1, Burst: 1, IntervalSeconds: 60, Overflow: OverflowSummarize})
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow("a", 1))
+	assert.False(t, l.Allow("a", 2))
+	assert.False(t, l.Allow("a", 3))
+
+	// The summary is due an interval after the first dropped event
+	now = now.Add(59 * time.Second)
+	assert.Empty(t, l.Flush(false))
+	now = now.Add(time.Second)
+	assert.Equal(t, []Summary{{Key: "a", Last: 3, Suppressed: 2, Since: start}}, l.Flush(false))
+	assert.Empty(t, l.Flush(true))
+
+	assert.True(t, l.Allow("a", 4))
+	assert.False(t, l.Allow("a", 5))
+	assert.Equal(t, []Summary{{Key: "a", Last: 5, Suppressed: 1, Since: now}}, l.Flush(true))
+}
+
+func TestLimiter_SummarizeEvicted(t *testing.T) {
+	now := time.Now()
+	start := now
+	l := New(Config{Limit: 1, IntervalSeconds: 60, Overflow: OverflowSummarize, MaxKeys: 1})
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow("a", 1))
+	assert.False(t, l.Allow("a", 2))
+
+	// The bucket of a is forgotten for b, its summary is reported right away
+	now = now.Add(time.Second)
+	assert.True(t, l.Allow("b", 1))
+	assert.Equal(t, []Summary{{Key: "a", Last: 2, Suppressed: 1, Since: start}}, l.Flush(false))
+	assert.Empty(t, l.Flush(true))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, (&Config{Limit: 10}).Validate())
+	require.NoError(t, (&Config{Limit: 10, Overflow: OverflowSummarize}).Validate())
+	require.Error(t, (&Config{}).Validate())
+	require.Error(t, (&Config{Limit: 10, Burst: -1}).Validate())
+	require.Error(t, (&Config{Limit: 10, Overflow: "queue"}).Validate())
+}
@@ -1,6 +1,11 @@
 package sinks
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/resmoio/kubernetes-event-exporter/pkg/ratelimit"
+)
 
 // Receiver allows receiving
 type ReceiverConfig struct {
@@ -26,6 +31,35 @@ type ReceiverConfig struct {
 	BigQuery      *BigQueryConfig      `yaml:"bigquery"`
 	EventBridge   *EventBridgeConfig   `yaml:"eventbridge"`
 	Pipe          *PipeConfig          `yaml:"pipe"`
+	// RateLimit limits the events sent to the receiver
+	RateLimit *ratelimit.Config `yaml:"rateLimit"`
+	// Group sends a digest per group of events instead of every event
+	Group *GroupConfig `yaml:"group"`
+}
+
+// GroupConfig collects the events of a receiver by a key, like the grouping of Alertmanager. The first digest of a
+// group is sent once the group waited for more events, later ones once per interval if there are new events.
+type GroupConfig struct {
+	// By is a template of the event, the events with the same key are grouped. Defaults to the namespace.
+	By string `yaml:"by"`
+	// WaitSeconds is how long a new group waits for more events, defaults to 30
+	WaitSeconds int64 `yaml:"waitSeconds"`
+	// IntervalSeconds is how long a group waits between digests, defaults to 300
+	IntervalSeconds int64 `yaml:"intervalSeconds"`
+}
+
+func (c *GroupConfig) GetWait() time.Duration {
+	if c.WaitSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.WaitSeconds) * time.Second
+}
+
+func (c *GroupConfig) GetInterval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
 }
 
 func (r *ReceiverConfig) Validate() error {
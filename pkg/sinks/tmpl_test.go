@@ -50,3 +50,18 @@ func TestLayoutConvert(t *testing.T) {
 
 	require.Equal(t, val2, ev.Message)
 }
+
+func TestGroupTemplate(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "default"
+	ev.Group = &kube.EventGroup{
+		Key:     "default",
+		Count:   3,
+		Reasons: []kube.GroupReason{{Reason: "BackOff", Type: "Warning", Count: 2}, {Reason: "FailedMount", Type: "Warning", Count: 1}},
+		Objects: []kube.GroupObject{{Kind: "Pod", Namespace: "default", Name: "web-1", Count: 3}},
+	}
+
+	text, err := GetString(ev, `{{ .Group.Count }} events in {{ .Group.Key }}:{{ range .Group.Reasons }} {{ .Reason }} ({{ .Count }}){{ end }}{{ range .Group.Objects }} {{ .Kind }}/{{ .Name }}{{ end }}`)
+	require.NoError(t, err)
+	require.Equal(t, "3 events in default: BackOff (2) FailedMount (1) Pod/web-1", text)
+}